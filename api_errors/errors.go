@@ -6,8 +6,11 @@ import (
 )
 
 type E struct {
-	code   int
-	errors map[string][]string
+	code    int
+	errors  map[string][]string
+	headers map[string]string
+	// validation errors are sent wrapped in "errors" field, as the spec requires
+	wrapped bool
 }
 
 func (e E) Error() string {
@@ -16,7 +19,15 @@ func (e E) Error() string {
 }
 
 func (e E) Send(w http.ResponseWriter) {
-	body, _ := json.Marshal(e.errors)
+	var body []byte
+	if e.wrapped {
+		body, _ = json.Marshal(map[string]interface{}{"errors": e.errors})
+	} else {
+		body, _ = json.Marshal(e.errors)
+	}
+	for key, value := range e.headers {
+		w.Header().Set(key, value)
+	}
 	w.WriteHeader(e.code)
 	w.Write(body)
 }
@@ -25,9 +36,22 @@ func NewError(code int) *E {
 	return &E{
 		code,
 		map[string][]string{},
+		map[string]string{},
+		false,
 	}
 }
 
+// 422 error in the spec format: {"errors": {"field": ["message"]}}
+func NewValidationError() *E {
+	e := NewError(http.StatusUnprocessableEntity)
+	e.wrapped = true
+	return e
+}
+
+func (e *E) HasErrors() bool {
+	return len(e.errors) > 0
+}
+
 func (e *E) Add(key string, error string) *E {
 	if e.errors[key] != nil {
 		e.errors[key] = append(e.errors[key], error)
@@ -41,3 +65,9 @@ func (e *E) SetCode(code int) *E {
 	e.code = code
 	return e
 }
+
+// Header is sent together with the error, e.g. Retry-After
+func (e *E) SetHeader(key string, value string) *E {
+	e.headers[key] = value
+	return e
+}
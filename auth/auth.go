@@ -1,50 +1,94 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
-	"golang.org/x/crypto/bcrypt"
+	"strconv"
+	"strings"
 	"time"
 )
 
-var signature = []byte("Change this with SIGNATURE env variable")
+var accessTokenTTL = time.Minute * 15
+
+var refreshTokenTTL = time.Hour * 24 * 30
 
 func expireDuration() time.Duration {
-	return time.Hour * 100
+	return accessTokenTTL
+}
+
+func SetAccessTokenTTL(d time.Duration) {
+	accessTokenTTL = d
+}
+
+func SetRefreshTokenTTL(d time.Duration) {
+	refreshTokenTTL = d
 }
 
-func SetSignature(s string) {
-	signature = []byte(s)
+func RefreshTokenTTL() time.Duration {
+	return refreshTokenTTL
 }
 
+// Family ties an access token to the refresh token chain it was issued from,
+// so that revoking the chain also kills access tokens that are still alive.
+// Purpose is empty for access tokens and set for single purpose tokens like email verification links,
+// which are never accepted as access tokens.
+// Role is informational for clients, permissions are checked against the stored user so role changes apply at once.
+// Subject is the id of the user, email can change while the token is alive and is informational too
 type Claims struct {
 	jwt.StandardClaims
-	Email string `json:"email"`
+	Email   string `json:"email"`
+	Family  string `json:"fam,omitempty"`
+	Purpose string `json:"pur,omitempty"`
+	Role    string `json:"role,omitempty"`
+}
+
+// Random url-safe string with n bytes of entropy, used for token ids and opaque tokens
+func RandomToken(n int) string {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(fmt.Sprintf("Could not read random bytes: %s", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Opaque tokens are stored only as hashes, so a leaked table can not be replayed
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
-func PasswordToHash(password string) string {
-	phash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(phash)
+// Personal access tokens are opaque, the prefix tells them apart from jwt and helps secret scanners find leaked ones
+const accessTokenPrefix = "cpat_"
+
+func NewAccessTokenString() string {
+	return accessTokenPrefix + RandomToken(32)
 }
 
-func CheckPassword(password string, storedHash string) error {
-	return bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(password))
+func IsAccessTokenString(tokenString string) bool {
+	return strings.HasPrefix(tokenString, accessTokenPrefix)
 }
 
-func GetToken(email string) *jwt.Token {
-	claims := Claims{
+func getClaims(userID uint, email string, family string, role string) *Claims {
+	return &Claims{
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: time.Now().Add(expireDuration()).Unix(),
 			IssuedAt:  time.Now().Unix(),
+			Id:        RandomToken(16),
+			Subject:   strconv.FormatUint(uint64(userID), 10),
 		},
-		Email: email,
+		Email:  email,
+		Family: family,
+		Role:   role,
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims)
-	return token
 }
 
-func GetTokenString(email string) string {
-	result, err := GetToken(email).SignedString(signature)
+func GetTokenString(userID uint, email string, family string, role string) string {
+	result, err := sign(getClaims(userID, email, family, role))
 	if err != nil {
 		panic(fmt.Sprintf("Could not get token string from token: %s", err))
 	}
@@ -52,47 +96,42 @@ func GetTokenString(email string) string {
 }
 
 func ValidateTokenStringWithEmail(tokenString string, email string) error {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, KeyFunc)
+	claims, err := GetClaimsFromTokenString(tokenString)
 	if err != nil {
-		return fmt.Errorf(fmt.Sprintf("could not authenticate token: %s", err.Error()))
+		return err
 	}
-	claims, ok := token.Claims.(*Claims)
-	if ok && token.Valid && claims.Email == email {
-		return nil
-	} else {
-		return fmt.Errorf("could not authorize token: %s", claims.Valid().Error())
+	if claims.Email != email {
+		return fmt.Errorf("could not authorize token: token belongs to another email")
 	}
+	return nil
 }
 
 func ValidateTokenString(tokenString string) error {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, KeyFunc)
+	_, err := GetClaimsFromTokenString(tokenString)
+	return err
+}
+
+// Id of the user the token was issued for, false for tokens issued before subject was set
+func (c *Claims) UserID() (uint, bool) {
+	id, err := strconv.ParseUint(c.Subject, 10, 64)
 	if err != nil {
-		return fmt.Errorf("could not authenticate token: %s", err.Error())
-	}
-	claims, ok := token.Claims.(*Claims)
-	if ok && token.Valid {
-		return nil
-	} else {
-		return fmt.Errorf("could not authorize token: %s", claims.Valid().Error())
+		return 0, false
 	}
+	return uint(id), true
+}
+
+// Claims of a valid access token
+func GetClaimsFromTokenString(tokenString string) (*Claims, error) {
+	return GetPurposeClaims(tokenString, "")
 }
 
 func GetEmailFromTokenString(tokenString string) (string, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, KeyFunc)
+	claims, err := GetClaimsFromTokenString(tokenString)
 	if err != nil {
 		return "", err
 	}
-	claims, ok := token.Claims.(*Claims)
-	if ok && claims.Email != "" {
-		return claims.Email, nil
-	} else {
+	if claims.Email == "" {
 		return "", fmt.Errorf("could not get email from token")
 	}
-}
-
-func KeyFunc(token *jwt.Token) (interface{}, error) {
-	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-		return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-	}
-	return signature, nil
+	return claims.Email, nil
 }
@@ -2,12 +2,22 @@ package auth_test
 
 import (
 	"../auth"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/dgrijalva/jwt-go"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetTokenString(t *testing.T) {
 	email := "saergdgfg"
-	result := auth.GetTokenString(email)
+	result := auth.GetTokenString(1, email, "", "")
 	if result == "" {
 		t.Fatalf("could not get token string")
 	}
@@ -22,3 +32,230 @@ func TestRandomTokenIsInvalid(t *testing.T) {
 		t.Fatalf("random string is not validated as token")
 	}
 }
+
+func TestTokenHasSubjectFamilyIDAndRole(t *testing.T) {
+	family := auth.RandomToken(16)
+	claims, err := auth.GetClaimsFromTokenString(auth.GetTokenString(1, "sdfsdf", family, "moderator"))
+	if err != nil {
+		t.Fatalf("could not get claims from token: %s", err)
+	}
+	if claims.Family != family {
+		t.Fatalf("token has family %s, expected %s", claims.Family, family)
+	}
+	if claims.Id == "" {
+		t.Fatalf("token has no id")
+	}
+	if claims.Role != "moderator" {
+		t.Fatalf("token has role %s, expected moderator", claims.Role)
+	}
+	if id, ok := claims.UserID(); !ok || id != 1 {
+		t.Fatalf("token has subject %s, expected user id 1", claims.Subject)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	defer auth.SetSignature("Change this with SIGNATURE env variable")
+	err := auth.SetKeys([]auth.Key{{ID: "old", Secret: "old secret"}}, "old")
+	if err != nil {
+		t.Fatalf("could not set keys: %s", err)
+	}
+	oldToken := auth.GetTokenString(1, "sdfsdf", "", "")
+
+	err = auth.SetKeys([]auth.Key{{ID: "old", Secret: "old secret"}, {ID: "new", Secret: "new secret"}}, "new")
+	if err != nil {
+		t.Fatalf("could not rotate keys: %s", err)
+	}
+	if auth.ValidateTokenString(oldToken) != nil {
+		t.Fatalf("token signed with previous key is not valid after rotation")
+	}
+	if auth.ValidateTokenString(auth.GetTokenString(1, "sdfsdf", "", "")) != nil {
+		t.Fatalf("token signed with new key is not valid")
+	}
+
+	if auth.RetireKey("new", time.Now()) == nil {
+		t.Fatalf("active key was retired")
+	}
+	retireErr := auth.RetireKey("old", time.Now().Add(-time.Hour*24*365))
+	if retireErr != nil {
+		t.Fatalf("could not retire key: %s", retireErr)
+	}
+	if auth.ValidateTokenString(oldToken) == nil {
+		t.Fatalf("token signed with retired key is still valid")
+	}
+	removed := auth.PruneRetiredKeys()
+	if len(removed) != 1 || removed[0] != "old" {
+		t.Fatalf("retired key was not pruned: %v", removed)
+	}
+}
+
+func writeKeyFile(t *testing.T, key interface{}) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("could not marshal key: %s", err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	err = ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatalf("could not write key file: %s", err)
+	}
+	return path
+}
+
+func TestAsymmetricKeys(t *testing.T) {
+	defer auth.SetSignature("Change this with SIGNATURE env variable")
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	list := []auth.Key{
+		{ID: "hmac", Secret: "secret"},
+		{ID: "rsa", File: writeKeyFile(t, rsaKey)},
+		{ID: "ed", File: writeKeyFile(t, edKey)},
+	}
+
+	for _, k := range list {
+		err := auth.SetKeys(list, k.ID)
+		if err != nil {
+			t.Fatalf("could not set keys: %s", err)
+		}
+		claims, claimsErr := auth.GetClaimsFromTokenString(auth.GetTokenString(1, "sdfsdf", "", ""))
+		if claimsErr != nil || claims.Email != "sdfsdf" {
+			t.Fatalf("token signed with %s key is invalid: %s", k.ID, claimsErr)
+		}
+	}
+
+	jwks := auth.PublicKeys()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("expected rsa and ed25519 keys to be published, got %+v", jwks.Keys)
+	}
+	for _, k := range jwks.Keys {
+		if k.Kid == "hmac" {
+			t.Fatalf("hmac secret was published")
+		}
+	}
+}
+
+func TestAlgorithmFromTokenIsIgnored(t *testing.T) {
+	defer auth.SetSignature("Change this with SIGNATURE env variable")
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	err := auth.SetKeys([]auth.Key{{ID: "ed", File: writeKeyFile(t, edKey)}}, "ed")
+	if err != nil {
+		t.Fatalf("could not set keys: %s", err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &auth.Claims{Email: "sdfsdf"})
+	token.Header["kid"] = "ed"
+	forged, _ := token.SignedString([]byte(edKey.Public().(ed25519.PublicKey)))
+	if auth.ValidateTokenString(forged) == nil {
+		t.Fatalf("HS256 token signed with public key was accepted")
+	}
+}
+
+func TestPurposeTokenIsNotAccessToken(t *testing.T) {
+	token := auth.GetPurposeTokenString(auth.PurposeVerifyEmail, "1", "sdfsdf", time.Hour)
+	if auth.ValidateTokenString(token) == nil {
+		t.Fatalf("verification token was accepted as access token")
+	}
+	claims, err := auth.GetPurposeClaims(token, auth.PurposeVerifyEmail)
+	if err != nil {
+		t.Fatalf("could not get claims of verification token: %s", err)
+	}
+	if claims.Subject != "1" || claims.Email != "sdfsdf" {
+		t.Fatalf("verification token has wrong claims: %+v", claims)
+	}
+	_, accessErr := auth.GetPurposeClaims(auth.GetTokenString(1, "sdfsdf", "", ""), auth.PurposeVerifyEmail)
+	if accessErr == nil {
+		t.Fatalf("access token was accepted as verification token")
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	// test vector from RFC 6238 appendix B, truncated to 6 digits
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	code, err := auth.TOTPCode(secret, auth.TOTPStep(time.Unix(59, 0)))
+	if err != nil {
+		t.Fatalf("could not get totp code: %s", err)
+	}
+	if code != "287082" {
+		t.Fatalf("totp code %s does not match RFC 6238 test vector", code)
+	}
+	if _, ok := auth.ValidateTOTP(secret, "287082", time.Unix(59+30, 0)); !ok {
+		t.Fatalf("code from previous step is not accepted")
+	}
+	if _, ok := auth.ValidateTOTP(secret, "287082", time.Unix(59+90, 0)); ok {
+		t.Fatalf("outdated code is accepted")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes := auth.GenerateRecoveryCodes(10)
+	if len(codes) != 10 {
+		t.Fatalf("expected 10 recovery codes, got %d", len(codes))
+	}
+	if auth.NormalizeRecoveryCode(strings.ToUpper(strings.Replace(codes[0], "-", " ", 1))) != codes[0] {
+		t.Fatalf("recovery code is not normalized")
+	}
+}
+
+func TestArgon2idPassword(t *testing.T) {
+	hash, err := auth.PasswordToHash("sdfgsdfg")
+	if err != nil {
+		t.Fatalf("could not hash password: %s", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$") {
+		t.Fatalf("password hash is not argon2id: %s", hash)
+	}
+	if auth.CheckPassword("sdfgsdfg", hash) != nil {
+		t.Fatalf("password does not match its hash")
+	}
+	if auth.CheckPassword("sdfgsdfh", hash) == nil {
+		t.Fatalf("wrong password matches hash")
+	}
+	if auth.PasswordNeedsRehash(hash) {
+		t.Fatalf("fresh hash needs rehash")
+	}
+
+	auth.SetPasswordHasher(&auth.Argon2idHasher{Time: 4, Memory: 32 * 1024, Threads: 2, KeyLen: 32, SaltLen: 16})
+	defer auth.SetPasswordHasher(auth.DefaultArgon2id)
+	if !auth.PasswordNeedsRehash(hash) {
+		t.Fatalf("hash with old parameters does not need rehash")
+	}
+	if auth.CheckPassword("sdfgsdfg", hash) != nil {
+		t.Fatalf("hash with old parameters is not verified")
+	}
+}
+
+func TestLegacyBcryptPassword(t *testing.T) {
+	hash, err := auth.DefaultBcrypt.Hash("sdfgsdfg")
+	if err != nil {
+		t.Fatalf("could not hash password: %s", err)
+	}
+	if auth.CheckPassword("sdfgsdfg", hash) != nil {
+		t.Fatalf("bcrypt hash is not verified")
+	}
+	if !auth.PasswordNeedsRehash(hash) {
+		t.Fatalf("bcrypt hash does not need rehash")
+	}
+	_, longErr := auth.DefaultBcrypt.Hash(strings.Repeat("a", 73))
+	if longErr == nil {
+		t.Fatalf("bcrypt silently truncated long password")
+	}
+	_, tooLongErr := auth.PasswordToHash(strings.Repeat("a", auth.MaxPasswordLength+1))
+	if tooLongErr != auth.ErrPasswordTooLong {
+		t.Fatalf("too long password was hashed")
+	}
+}
+
+func TestBreachedPassword(t *testing.T) {
+	dir := t.TempDir()
+	// sha1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	err := ioutil.WriteFile(filepath.Join(dir, "5BAA6"), []byte("003D68EB55068C33ACE09247EE4C639306B:3\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493\r\n"), 0600)
+	if err != nil {
+		t.Fatalf("could not write range file: %s", err)
+	}
+	breached, err := auth.IsBreachedPassword(dir, "password")
+	if err != nil || !breached {
+		t.Fatalf("breached password is not found: %v", err)
+	}
+	breached, err = auth.IsBreachedPassword(dir, "sdfgsdfgsdfg")
+	if err != nil || breached {
+		t.Fatalf("password without range file is reported breached: %v", err)
+	}
+}
@@ -0,0 +1,333 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"io/ioutil"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Tokens without kid header were signed before key rotation existed, they are checked with this key
+const legacyKeyID = "default"
+
+// Only the active key signs new tokens, the other keys are kept to verify tokens signed before rotation.
+// A retired key stops verifying once every token it could have signed has expired.
+// HS256 keys have a Secret, RS256 and EdDSA keys are read from a PEM File with a private or public key;
+// keys with only a public key can verify but not sign
+type Key struct {
+	ID        string     `json:"kid"`
+	Alg       string     `json:"alg,omitempty"`
+	Secret    string     `json:"secret,omitempty"`
+	File      string     `json:"file,omitempty"`
+	RetiredAt *time.Time `json:"retiredAt,omitempty"`
+
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+type keyringConfig struct {
+	Active string `json:"active"`
+	Keys   []Key  `json:"keys"`
+}
+
+type keyring struct {
+	mu     sync.RWMutex
+	keys   map[string]Key
+	active string
+}
+
+var keys = &keyring{}
+
+func init() {
+	SetSignature("Change this with SIGNATURE env variable")
+}
+
+// Longest lifetime of a token signed with keyring keys
+func maxTokenTTL() time.Duration {
+	if accessTokenTTL > maxPurposeTokenTTL {
+		return accessTokenTTL
+	}
+	return maxPurposeTokenTTL
+}
+
+func (k Key) expired(now time.Time) bool {
+	return k.RetiredAt != nil && now.After(k.RetiredAt.Add(maxTokenTTL()))
+}
+
+// Fills signing method and keys from the secret or PEM file
+func (k Key) prepare() (Key, error) {
+	if k.ID == "" {
+		return k, fmt.Errorf("signing keys should have kid")
+	}
+	if k.File == "" {
+		if k.Secret == "" {
+			return k, fmt.Errorf("signing key %s should have secret or file", k.ID)
+		}
+		if k.Alg != "" && k.Alg != jwt.SigningMethodHS256.Alg() {
+			return k, fmt.Errorf("signing key %s with secret should be HS256", k.ID)
+		}
+		k.Alg = jwt.SigningMethodHS256.Alg()
+		k.method = jwt.SigningMethodHS256
+		k.signKey = []byte(k.Secret)
+		k.verifyKey = []byte(k.Secret)
+		return k, nil
+	}
+
+	data, readErr := ioutil.ReadFile(k.File)
+	if readErr != nil {
+		return k, fmt.Errorf("could not read signing key %s: %s", k.ID, readErr)
+	}
+	signKey, verifyKey, err := parsePEMKey(data)
+	if err != nil {
+		return k, fmt.Errorf("could not parse signing key %s: %s", k.ID, err)
+	}
+	var method jwt.SigningMethod
+	switch verifyKey.(type) {
+	case *rsa.PublicKey:
+		method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		method = SigningMethodEd25519
+	}
+	if k.Alg != "" && k.Alg != method.Alg() {
+		return k, fmt.Errorf("signing key %s is %s, not %s", k.ID, method.Alg(), k.Alg)
+	}
+	k.Alg = method.Alg()
+	k.method = method
+	k.signKey = signKey
+	k.verifyKey = verifyKey
+	return k, nil
+}
+
+// Returns private key, if there is one, and public key from RSA or Ed25519 PEM
+func parsePEMKey(data []byte) (interface{}, interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, fmt.Errorf("no PEM data found")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, &key.PublicKey, nil
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, key, nil
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			return k, &k.PublicKey, nil
+		case ed25519.PrivateKey:
+			return k, k.Public(), nil
+		}
+		return nil, nil, fmt.Errorf("only RSA and Ed25519 keys are supported")
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch k := key.(type) {
+		case *rsa.PublicKey:
+			return nil, k, nil
+		case ed25519.PublicKey:
+			return nil, k, nil
+		}
+		return nil, nil, fmt.Errorf("only RSA and Ed25519 keys are supported")
+	}
+	return nil, nil, fmt.Errorf("unsupported PEM block %s", block.Type)
+}
+
+// Replaces the keyring with a single key, kept for deployments that only set SIGNATURE
+func SetSignature(s string) {
+	_ = SetKeys([]Key{{ID: legacyKeyID, Secret: s}}, legacyKeyID)
+}
+
+func SetKeys(list []Key, active string) error {
+	result := map[string]Key{}
+	for _, k := range list {
+		prepared, err := k.prepare()
+		if err != nil {
+			return err
+		}
+		if _, found := result[k.ID]; found {
+			return fmt.Errorf("duplicate signing key id %s", k.ID)
+		}
+		result[k.ID] = prepared
+	}
+	activeKey, found := result[active]
+	if !found {
+		return fmt.Errorf("active signing key %s is not in the keyring", active)
+	}
+	if activeKey.RetiredAt != nil {
+		return fmt.Errorf("active signing key %s is retired", active)
+	}
+	if activeKey.signKey == nil {
+		return fmt.Errorf("active signing key %s has no private key", active)
+	}
+	keys.mu.Lock()
+	defer keys.mu.Unlock()
+	keys.keys = result
+	keys.active = active
+	return nil
+}
+
+// Reads keyring from a json file:
+// {"active": "kid", "keys": [{"kid": "...", "secret": "...", "retiredAt": "RFC3339"}, {"kid": "...", "file": "key.pem"}]}
+func LoadKeyringFile(path string) error {
+	data, readErr := ioutil.ReadFile(path)
+	if readErr != nil {
+		return fmt.Errorf("could not read keyring file: %s", readErr)
+	}
+	var config keyringConfig
+	err := json.Unmarshal(data, &config)
+	if err != nil {
+		return fmt.Errorf("could not parse keyring file: %s", err)
+	}
+	return SetKeys(config.Keys, config.Active)
+}
+
+// Retired key does not sign anymore and is dropped after tokens it signed expire
+func RetireKey(kid string, at time.Time) error {
+	keys.mu.Lock()
+	defer keys.mu.Unlock()
+	k, found := keys.keys[kid]
+	if !found {
+		return fmt.Errorf("signing key %s not found", kid)
+	}
+	if kid == keys.active {
+		return fmt.Errorf("can not retire active signing key %s", kid)
+	}
+	k.RetiredAt = &at
+	keys.keys[kid] = k
+	return nil
+}
+
+// Removes retired keys that can not have any valid tokens left and returns their ids
+func PruneRetiredKeys() []string {
+	keys.mu.Lock()
+	defer keys.mu.Unlock()
+	now := time.Now()
+	var removed []string
+	for id, k := range keys.keys {
+		if k.expired(now) {
+			delete(keys.keys, id)
+			removed = append(removed, id)
+		}
+	}
+	return removed
+}
+
+func activeKey() Key {
+	keys.mu.RLock()
+	defer keys.mu.RUnlock()
+	return keys.keys[keys.active]
+}
+
+func findKey(kid string) (Key, bool) {
+	keys.mu.RLock()
+	defer keys.mu.RUnlock()
+	k, found := keys.keys[kid]
+	return k, found
+}
+
+// Signs claims with the active key and puts its id to the kid header
+func sign(claims jwt.Claims) (string, error) {
+	k := activeKey()
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.ID
+	return token.SignedString(k.signKey)
+}
+
+func KeyFunc(token *jwt.Token) (interface{}, error) {
+	kid := legacyKeyID
+	if h, found := token.Header["kid"]; found {
+		s, ok := h.(string)
+		if !ok {
+			return nil, fmt.Errorf("kid header should be a string")
+		}
+		kid = s
+	}
+	k, found := findKey(kid)
+	if !found {
+		return nil, fmt.Errorf("unknown signing key %s", kid)
+	}
+	// algorithm comes from the key, never from the token, otherwise a public key could be used as HMAC secret
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+	}
+	if k.expired(time.Now()) {
+		return nil, fmt.Errorf("signing key %s is retired", kid)
+	}
+	return k.verifyKey, nil
+}
+
+// Public key in RFC 7517 format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Public keys of asymmetric keys that can still verify tokens, HMAC secrets are never published
+func PublicKeys() JWKSet {
+	keys.mu.RLock()
+	defer keys.mu.RUnlock()
+	now := time.Now()
+	result := JWKSet{Keys: []JWK{}}
+	for _, k := range keys.keys {
+		if k.expired(now) {
+			continue
+		}
+		switch pub := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			result.Keys = append(result.Keys, JWK{
+				Kty: "RSA",
+				Kid: k.ID,
+				Use: "sig",
+				Alg: k.Alg,
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			result.Keys = append(result.Keys, JWK{
+				Kty: "OKP",
+				Kid: k.ID,
+				Use: "sig",
+				Alg: k.Alg,
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	sort.Slice(result.Keys, func(i, j int) bool {
+		return result.Keys[i].Kid < result.Keys[j].Kid
+	})
+	return result
+}
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// Longer passwords are rejected before hashing, so a huge password can not be used to burn cpu
+const MaxPasswordLength = 1024
+
+var ErrPasswordTooLong = errors.New("password is too long")
+
+var errUnknownHash = errors.New("unknown password hash format")
+
+// Hashes passwords with one algorithm and verifies hashes it produced, recognised by Handles
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password string, encoded string) error
+	Handles(encoded string) bool
+	// True when the hash was made by this algorithm with other parameters
+	NeedsRehash(encoded string) bool
+}
+
+// Argon2idHasher encodes hashes in the PHC string format: $argon2id$v=19$m=65536,t=3,p=4$salt$hash
+type Argon2idHasher struct {
+	Time    uint32
+	Memory  uint32 // KiB
+	Threads uint8
+	KeyLen  uint32
+	SaltLen uint32
+}
+
+// Second recommended option of RFC 9106, for machines that can not spend 2 GiB per hash
+var DefaultArgon2id = &Argon2idHasher{Time: 3, Memory: 64 * 1024, Threads: 4, KeyLen: 32, SaltLen: 16}
+
+const argon2idPrefix = "$argon2id$"
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLen)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+	return fmt.Sprintf(
+		"%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Handles(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
+
+type argon2idHash struct {
+	params Argon2idHasher
+	salt   []byte
+	key    []byte
+}
+
+func parseArgon2id(encoded string) (*argon2idHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, errUnknownHash
+	}
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2 version %s", parts[2])
+	}
+	var result argon2idHash
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &result.params.Memory, &result.params.Time, &result.params.Threads)
+	if err != nil {
+		return nil, fmt.Errorf("could not read argon2 parameters: %s", err)
+	}
+	result.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, fmt.Errorf("could not read argon2 salt: %s", err)
+	}
+	result.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, fmt.Errorf("could not read argon2 hash: %s", err)
+	}
+	result.params.SaltLen = uint32(len(result.salt))
+	result.params.KeyLen = uint32(len(result.key))
+	return &result, nil
+}
+
+func (h *Argon2idHasher) Verify(password string, encoded string) error {
+	stored, err := parseArgon2id(encoded)
+	if err != nil {
+		return err
+	}
+	p := stored.params
+	key := argon2.IDKey([]byte(password), stored.salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+	if subtle.ConstantTimeCompare(key, stored.key) != 1 {
+		return fmt.Errorf("password does not match")
+	}
+	return nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	stored, err := parseArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return stored.params != *h
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+var DefaultBcrypt = &BcryptHasher{Cost: bcrypt.DefaultCost}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h *BcryptHasher) Handles(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h *BcryptHasher) Verify(password string, encoded string) error {
+	return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
+
+// New hashes are made with the current hasher, the others are only used to verify existing hashes
+var currentHasher PasswordHasher = DefaultArgon2id
+
+var passwordHashers = []PasswordHasher{DefaultArgon2id, DefaultBcrypt}
+
+func SetPasswordHasher(h PasswordHasher) {
+	currentHasher = h
+}
+
+func hasherFor(encoded string) PasswordHasher {
+	if currentHasher.Handles(encoded) {
+		return currentHasher
+	}
+	for _, h := range passwordHashers {
+		if h.Handles(encoded) {
+			return h
+		}
+	}
+	return nil
+}
+
+func PasswordToHash(password string) (string, error) {
+	if len(password) > MaxPasswordLength {
+		return "", ErrPasswordTooLong
+	}
+	return currentHasher.Hash(password)
+}
+
+func CheckPassword(password string, storedHash string) error {
+	if len(password) > MaxPasswordLength {
+		return ErrPasswordTooLong
+	}
+	h := hasherFor(storedHash)
+	if h == nil {
+		return errUnknownHash
+	}
+	return h.Verify(password, storedHash)
+}
+
+// True when the hash was made by another algorithm or with other parameters than the current hasher uses
+func PasswordNeedsRehash(storedHash string) bool {
+	if !currentHasher.Handles(storedHash) {
+		return true
+	}
+	return currentHasher.NeedsRehash(storedHash)
+}
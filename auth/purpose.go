@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"time"
+)
+
+const (
+	PurposeVerifyEmail        = "verify_email"
+	PurposeTwoFactorChallenge = "2fa_challenge"
+	PurposeUnlockAccount      = "unlock_account"
+)
+
+// Single purpose tokens live at most this long, so retired keys can be dropped in predictable time
+const maxPurposeTokenTTL = time.Hour * 24 * 7
+
+// Signs a token that is only accepted for its purpose, subject is the id of the user it was issued for
+func GetPurposeTokenString(purpose string, subject string, email string, ttl time.Duration) string {
+	if ttl > maxPurposeTokenTTL {
+		ttl = maxPurposeTokenTTL
+	}
+	result, err := sign(&Claims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Id:        RandomToken(16),
+			Subject:   subject,
+		},
+		Email:   email,
+		Purpose: purpose,
+	})
+	if err != nil {
+		panic(fmt.Sprintf("Could not get token string from token: %s", err))
+	}
+	return result
+}
+
+func GetPurposeClaims(tokenString string, purpose string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, KeyFunc)
+	if err != nil {
+		return nil, fmt.Errorf("could not authenticate token: %s", err.Error())
+	}
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("could not authorize token")
+	}
+	if claims.Purpose != purpose {
+		return nil, fmt.Errorf("could not authorize token: token is issued for another purpose")
+	}
+	return claims, nil
+}
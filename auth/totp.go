@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RFC 6238 parameters, the ones every authenticator app supports
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// codes from one step before and after are accepted to tolerate clock drift
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func GenerateTOTPSecret() string {
+	b := make([]byte, 20)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(fmt.Sprintf("Could not read random bytes: %s", err))
+	}
+	return totpEncoding.EncodeToString(b)
+}
+
+// Key uri for authenticator apps, usually shown as QR code
+func TOTPURI(secret string, issuer string, account string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprintf("%d", totpDigits))
+	query.Set("period", fmt.Sprintf("%d", totpPeriod))
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, query.Encode())
+}
+
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("totp secret is not valid base32: %s", err)
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// Returns the time step the code belongs to, so that callers can refuse to accept the same step twice
+func ValidateTOTP(secret string, code string, t time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := TOTPStep(t)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// Single use codes for when the authenticator is lost, shown to the user once and stored as hashes
+func GenerateRecoveryCodes(n int) []string {
+	result := []string{}
+	for i := 0; i < n; i++ {
+		b := make([]byte, 10)
+		_, err := rand.Read(b)
+		if err != nil {
+			panic(fmt.Sprintf("Could not read random bytes: %s", err))
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(b))
+		result = append(result, code[:8]+"-"+code[8:])
+	}
+	return result
+}
+
+// Recovery codes are compared regardless of case, spaces and dashes the user typed
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.Replace(code, " ", "", -1)
+	code = strings.Replace(code, "-", "", -1)
+	if len(code) != 16 {
+		return code
+	}
+	return code[:8] + "-" + code[8:]
+}
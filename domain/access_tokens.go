@@ -0,0 +1,163 @@
+package domain
+
+import (
+	"../api_errors"
+	"../auth"
+	"../models"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type AccessTokenCreate struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// token does not expire when not set
+	ExpiresInDays uint `json:"expiresInDays"`
+}
+
+type AccessTokenResponse struct {
+	ID         uint     `json:"id"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	Prefix     string   `json:"prefix"`
+	CreatedAt  string   `json:"createdAt"`
+	ExpiresAt  *string  `json:"expiresAt"`
+	LastUsedAt *string  `json:"lastUsedAt"`
+	// secret is only shown once, when token is created
+	Token string `json:"token,omitempty"`
+}
+
+func formatOptionalTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	result := formatTime(*t)
+	return &result
+}
+
+func accessTokenToResponse(token *models.AccessToken) AccessTokenResponse {
+	return AccessTokenResponse{
+		ID:         token.ID,
+		Name:       token.Name,
+		Scopes:     strings.Fields(token.Scopes),
+		Prefix:     token.Prefix,
+		CreatedAt:  formatTime(token.CreatedAt),
+		ExpiresAt:  formatOptionalTime(token.ExpiresAt),
+		LastUsedAt: formatOptionalTime(token.LastUsedAt),
+	}
+}
+
+func hasScope(scopes string, scope string) bool {
+	if scope == "" {
+		return true
+	}
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func authenticateAccessToken(tokenString string, client Client) (*Actor, *api_errors.E) {
+	invalid := api_errors.NewError(http.StatusUnauthorized).Add("token", "token is invalid")
+	token, err := models.GetAccessToken(auth.HashToken(tokenString))
+	if err != nil {
+		return nil, invalid
+	}
+	if token.ExpiresAt != nil && token.ExpiresAt.Before(time.Now()) {
+		return nil, api_errors.NewError(http.StatusUnauthorized).Add("token", "token is expired")
+	}
+	user, userErr := models.GetUserByID(token.UserID)
+	if userErr != nil {
+		return nil, invalid
+	}
+	touchErr := models.TouchAccessToken(token.ID)
+	if touchErr != nil {
+		log.Printf("could not update access token last use: %s", touchErr)
+	}
+	return &Actor{User: user, Token: tokenString, Client: client, scopes: token.Scopes}, nil
+}
+
+func CreateAccessToken(c AccessTokenCreate, actor *Actor) (*AccessTokenResponse, *api_errors.E) {
+	user, userErr := actor.user(ScopeSession)
+	if userErr != nil {
+		return nil, userErr
+	}
+
+	validationErr := api_errors.NewError(http.StatusUnprocessableEntity)
+	valid := true
+	if strings.TrimSpace(c.Name) == "" {
+		validationErr.Add("name", "can't be blank")
+		valid = false
+	}
+	if len(c.Scopes) == 0 {
+		validationErr.Add("scopes", "can't be blank")
+		valid = false
+	}
+	for _, s := range c.Scopes {
+		if !hasScope(strings.Join(grantableScopes, " "), s) {
+			validationErr.Add("scopes", fmt.Sprintf("%s is not a valid scope", s))
+			valid = false
+		}
+	}
+	if !valid {
+		return nil, validationErr
+	}
+
+	secret := auth.NewAccessTokenString()
+	token := models.AccessToken{
+		UserID:    user.ID,
+		Name:      strings.TrimSpace(c.Name),
+		TokenHash: auth.HashToken(secret),
+		Prefix:    secret[:12],
+		Scopes:    strings.Join(c.Scopes, " "),
+	}
+	if c.ExpiresInDays > 0 {
+		expiresAt := time.Now().Add(time.Hour * 24 * time.Duration(c.ExpiresInDays))
+		token.ExpiresAt = &expiresAt
+	}
+	err := models.CreateAccessToken(&token)
+	if err != nil {
+		return nil, api_errors.NewError(http.StatusInternalServerError).Add("token", "could not create token")
+	}
+	auditActor(AuditAccessTokenCreate, actor, user, fmt.Sprintf("%s (%s)", token.Name, token.Scopes))
+	response := accessTokenToResponse(&token)
+	response.Token = secret
+	return &response, nil
+}
+
+func ListAccessTokens(actor *Actor) (*[]AccessTokenResponse, *api_errors.E) {
+	user, userErr := actor.user(ScopeSession)
+	if userErr != nil {
+		return nil, userErr
+	}
+	tokens, err := models.ListAccessTokens(user.ID)
+	if err != nil {
+		return nil, api_errors.NewError(http.StatusInternalServerError).Add("tokens", "could not get tokens")
+	}
+	result := []AccessTokenResponse{}
+	for i := range *tokens {
+		result = append(result, accessTokenToResponse(&(*tokens)[i]))
+	}
+	return &result, nil
+}
+
+func DeleteAccessToken(id uint, actor *Actor) *api_errors.E {
+	user, userErr := actor.user(ScopeSession)
+	if userErr != nil {
+		return userErr
+	}
+	deleted, err := models.DeleteAccessToken(user.ID, id)
+	if err != nil {
+		return api_errors.NewError(http.StatusInternalServerError).Add("token", "could not delete token")
+	}
+	if !deleted {
+		return api_errors.NewError(http.StatusNotFound).Add("token", "token not found")
+	}
+	auditActor(AuditAccessTokenDelete, actor, user, fmt.Sprintf("%d", id))
+	return nil
+}
@@ -0,0 +1,67 @@
+package domain_test
+
+import (
+	"../domain"
+	"testing"
+)
+
+func TestAccessTokenScopes(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createUser(t)
+	defer destroyArticle()
+	si, _ := domain.SignIn(userSignIn, testClient)
+
+	created, err := domain.CreateAccessToken(domain.AccessTokenCreate{
+		Name:   "ci",
+		Scopes: []string{domain.ScopeArticlesWrite},
+	}, identify(si.Token))
+	if err != nil {
+		t.Fatalf("could not create access token: %s", err)
+	}
+	if created.Token == "" {
+		t.Fatalf("created access token has no secret")
+	}
+
+	_, articleErr := domain.CreateArticle(articleCreate, identify(created.Token))
+	if articleErr != nil {
+		t.Fatalf("access token with articles:write could not create article: %s", articleErr)
+	}
+	_, followErr := domain.FollowUser(userCreate.Username, identify(created.Token))
+	if followErr == nil {
+		t.Fatalf("access token without profiles:write could follow")
+	}
+	username := "renamed"
+	_, updateErr := domain.UpdateUser(domain.UserUpdate{Username: &username}, identify(created.Token))
+	if updateErr == nil {
+		t.Fatalf("access token could update user")
+	}
+	_, listErr := domain.ListAccessTokens(identify(created.Token))
+	if listErr == nil {
+		t.Fatalf("access token could manage access tokens")
+	}
+
+	deleteErr := domain.DeleteAccessToken(created.ID, identify(si.Token))
+	if deleteErr != nil {
+		t.Fatalf("could not delete access token: %s", deleteErr)
+	}
+	if domain.CheckToken(created.Token, domain.ScopeArticlesWrite) == nil {
+		t.Fatalf("deleted access token is still valid")
+	}
+}
+
+func TestAccessTokenInvalidScope(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createUser(t)
+	defer destroyUser()
+	si, _ := domain.SignIn(userSignIn, testClient)
+
+	_, err := domain.CreateAccessToken(domain.AccessTokenCreate{
+		Name:   "ci",
+		Scopes: []string{domain.ScopeSession},
+	}, identify(si.Token))
+	if err == nil {
+		t.Fatalf("access token was created with session scope")
+	}
+}
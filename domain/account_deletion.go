@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"../api_errors"
+	"../auth"
+	"../models"
+	"log"
+	"net/http"
+)
+
+// What happens to articles and comments of a deleted account
+const (
+	// articles and comments are deleted with the account
+	DeleteContent = "delete"
+	// articles and comments stay, shown as written by "deleted user"
+	AnonymizeContent = "anonymize"
+)
+
+type AccountDelete struct {
+	Password string `json:"password"`
+	// DeleteContent or AnonymizeContent, defaults to AnonymizeContent
+	Content string `json:"content"`
+}
+
+// Deletes the account of actor after checking the password again.
+// Wrong passwords count as failed sign ins, so a stolen token can not be used to guess the password
+func DeleteAccount(d AccountDelete, actor *Actor) *api_errors.E {
+	user, userErr := actor.user(ScopeSession)
+	if userErr != nil {
+		return userErr
+	}
+	if d.Content == "" {
+		d.Content = AnonymizeContent
+	}
+	if d.Content != DeleteContent && d.Content != AnonymizeContent {
+		return api_errors.NewValidationError().Add("content", "must be delete or anonymize")
+	}
+
+	throttleErr := checkLoginThrottle(user.Email, actor.Client)
+	if throttleErr != nil {
+		return throttleErr
+	}
+	if auth.CheckPassword(d.Password, user.PasswordHash) != nil {
+		recordLoginFailure(user.Email, user, actor.Client)
+		return api_errors.NewError(http.StatusForbidden).Add("password", "is invalid")
+	}
+
+	exports, exportsErr := models.GetDataExportKeys(user.ID)
+	if exportsErr != nil {
+		log.Println(exportsErr)
+		return api_errors.NewError(http.StatusInternalServerError).Add("user", "could not delete account")
+	}
+	err := models.DeleteUser(user.ID, d.Content == AnonymizeContent)
+	if err != nil {
+		log.Println(err)
+		return api_errors.NewError(http.StatusInternalServerError).Add("user", "could not delete account")
+	}
+	deleteAvatar(user.ID, user.Image)
+	deleteDataExportFiles(exports)
+	auditActor(AuditAccountDelete, actor, user, d.Content)
+	return nil
+}
@@ -0,0 +1,95 @@
+package domain_test
+
+import (
+	"../domain"
+	"../models"
+	"testing"
+)
+
+func TestDeleteAccountNeedsPassword(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createUser(t)
+	defer destroyUser()
+	user, _ := domain.SignIn(userSignIn, testClient)
+
+	err := domain.DeleteAccount(domain.AccountDelete{Password: "wrongpassword"}, identify(user.Token))
+	if err == nil {
+		t.Fatalf("account deleted with wrong password")
+	}
+	d := domain.AccountDelete{Password: userCreate.Password, Content: "keep"}
+	err = domain.DeleteAccount(d, identify(user.Token))
+	if err == nil {
+		t.Fatalf("account deleted with unknown content choice")
+	}
+	if _, getErr := models.GetUser(userCreate.Email); getErr != nil {
+		t.Fatalf("account is gone after failed deletes")
+	}
+}
+
+func TestDeleteAccountWithContent(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createArticle(t)
+	defer destroyArticle()
+	user, _ := domain.SignIn(userSignIn, testClient)
+	slug := domain.SlugFromTitle(articleCreate.Title)
+
+	d := domain.AccountDelete{Password: userCreate.Password, Content: domain.DeleteContent}
+	err := domain.DeleteAccount(d, identify(user.Token))
+	if err != nil {
+		t.Fatalf("could not delete account: %s", err)
+	}
+	if _, getErr := models.GetUser(userCreate.Email); getErr == nil {
+		t.Fatalf("user still exists")
+	}
+	if _, getErr := models.GetArticle(slug); getErr == nil {
+		t.Fatalf("article of deleted user still exists")
+	}
+	if identify(user.Token) != nil {
+		t.Fatalf("token of deleted user still works")
+	}
+}
+
+func TestDeleteAccountAnonymizesContent(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createArticle(t)
+	defer destroyArticle()
+	user, _ := domain.SignIn(userSignIn, testClient)
+	slug := domain.SlugFromTitle(articleCreate.Title)
+
+	err := domain.DeleteAccount(domain.AccountDelete{Password: userCreate.Password}, identify(user.Token))
+	if err != nil {
+		t.Fatalf("could not delete account: %s", err)
+	}
+	if _, getErr := models.GetUser(userCreate.Email); getErr == nil {
+		t.Fatalf("user still exists")
+	}
+	article, getErr := models.GetArticle(slug)
+	if getErr != nil {
+		t.Fatalf("article of anonymized user is gone: %s", getErr)
+	}
+	if article.Author.Username != models.DeletedUserUsername {
+		t.Fatalf("article author is %s after anonymizing", article.Author.Username)
+	}
+}
+
+func TestDeletedUserEmailIsReserved(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createUser(t)
+	defer destroyUser()
+	user, _ := domain.SignIn(userSignIn, testClient)
+
+	impostor := domain.UserCreate{Username: "impostor", Email: models.DeletedUserEmail, Password: "i54tersdfg"}
+	_, err := domain.CreateUser(impostor, testClient)
+	if err == nil {
+		t.Fatalf("signed up with the deleted user email")
+	}
+	email := models.DeletedUserEmail
+	_, err = domain.UpdateUser(domain.UserUpdate{Email: &email}, identify(user.Token))
+	if err == nil {
+		t.Fatalf("changed email to the deleted user email")
+	}
+}
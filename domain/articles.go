@@ -2,7 +2,6 @@ package domain
 
 import (
 	"../api_errors"
-	"../auth"
 	"../models"
 	"fmt"
 	"net/http"
@@ -63,15 +62,15 @@ func tagsToTagList(tags []models.Tag) *[]string {
 	return &result
 }
 
-func CreateArticle(articleCreate ArticleCreate, tokenString string) (*ArticleResponse, *api_errors.E) {
-	email, emErr := auth.GetEmailFromTokenString(tokenString)
-	if emErr != nil {
-		return nil, api_errors.NewError(http.StatusUnauthorized).Add("token", "invalid token")
+func CreateArticle(articleCreate ArticleCreate, actor *Actor) (*ArticleResponse, *api_errors.E) {
+	user, uErr := actor.user(ScopeArticlesWrite)
+	if uErr != nil {
+		return nil, uErr
 	}
 
-	user, uErr := models.GetUser(email)
-	if uErr != nil {
-		return nil, api_errors.NewError(http.StatusNotFound).Add("user", "user not found")
+	verifiedErr := requireVerifiedEmail(user, RestrictArticles)
+	if verifiedErr != nil {
+		return nil, verifiedErr
 	}
 
 	article, err := models.CreateArticle(&models.Article{
@@ -85,27 +84,23 @@ func CreateArticle(articleCreate ArticleCreate, tokenString string) (*ArticleRes
 		return nil, api_errors.NewError(http.StatusUnprocessableEntity).Add("article", err.Error())
 	}
 
-	return articleToResponse(article, tokenString)
+	return articleToResponse(article, actor)
 }
 
-func articleToResponse(article *models.Article, tokenString string) (*ArticleResponse, *api_errors.E) {
+func articleToResponse(article *models.Article, actor *Actor) (*ArticleResponse, *api_errors.E) {
 	tags, tagErr := models.GetTagsForArticle(article.ID)
 	if tagErr != nil {
 		return nil, api_errors.NewError(http.StatusInternalServerError).Add("tagList", tagErr.Error())
 	}
 
-	authorProfile, authorErr := GetProfile(article.Author.Username, tokenString)
+	authorProfile, authorErr := GetProfile(article.Author.Username, actor)
 	if authorErr != nil {
 		return nil, api_errors.NewError(http.StatusInternalServerError).Add("author", authorErr.Error())
 	}
 
 	var favorited bool = false
-	if tokenString != "" {
-		email, _ := auth.GetEmailFromTokenString(tokenString)
-		user, _ := models.GetUser(email)
-		if user != nil {
-			favorited = models.IsArticleFavorited(article.ID, user.ID)
-		}
+	if user := viewer(actor); user != nil {
+		favorited = models.IsArticleFavorited(article.ID, user.ID)
 	}
 
 	return &ArticleResponse{
@@ -122,39 +117,54 @@ func articleToResponse(article *models.Article, tokenString string) (*ArticleRes
 	}, nil
 }
 
-func GetArticle(slug string, tokenString string) (*ArticleResponse, *api_errors.E) {
+// Article by slug, as not found when its author is private and actor may not see it
+func visibleArticle(slug string, actor *Actor) (*models.Article, *api_errors.E) {
 	article, err := models.GetArticle(slug)
 	if err != nil {
 		return nil, api_errors.NewError(http.StatusNotFound).Add("slug", err.Error())
 	}
-	return articleToResponse(article, tokenString)
+	if !article.Author.Private {
+		return article, nil
+	}
+	v := viewer(actor)
+	if v == nil || (v.ID != article.AuthorID && !models.IsFollowing(v.ID, article.AuthorID)) {
+		return nil, api_errors.NewError(http.StatusNotFound).Add("slug", "record not found")
+	}
+	return article, nil
 }
 
-func FavoriteArticle(slug string, tokenString string) (*ArticleResponse, *api_errors.E) {
-	email, _ := auth.GetEmailFromTokenString(tokenString)
-	user, userErr := models.GetUser(email)
+func GetArticle(slug string, actor *Actor) (*ArticleResponse, *api_errors.E) {
+	article, err := visibleArticle(slug, actor)
+	if err != nil {
+		return nil, err
+	}
+	return articleToResponse(article, actor)
+}
+
+func FavoriteArticle(slug string, actor *Actor) (*ArticleResponse, *api_errors.E) {
+	user, userErr := actor.user(ScopeArticlesWrite)
 	if userErr != nil {
-		return nil, api_errors.NewError(http.StatusUnauthorized).Add("token", "token invalid")
+		return nil, userErr
 	}
 
-	article, articleErr := models.GetArticle(slug)
+	article, articleErr := visibleArticle(slug, actor)
 	if articleErr != nil {
-		return nil, api_errors.NewError(http.StatusNotFound).Add("slug", articleErr.Error())
+		return nil, articleErr
 	}
 
 	err := models.FavoriteArticle(article.ID, user.ID)
 	if err != nil {
-		return nil, api_errors.NewError(http.StatusInternalServerError).Add("article", articleErr.Error())
+		return nil, api_errors.NewError(http.StatusInternalServerError).Add("article", err.Error())
 	}
+	notify(article.AuthorID, models.NotificationFavorite, &article.ID, user.ID)
 
-	return GetArticle(slug, tokenString)
+	return GetArticle(slug, actor)
 }
 
-func UnfavoriteArticle(slug string, tokenString string) (*ArticleResponse, *api_errors.E) {
-	email, _ := auth.GetEmailFromTokenString(tokenString)
-	user, userErr := models.GetUser(email)
+func UnfavoriteArticle(slug string, actor *Actor) (*ArticleResponse, *api_errors.E) {
+	user, userErr := actor.user(ScopeArticlesWrite)
 	if userErr != nil {
-		return nil, api_errors.NewError(http.StatusUnauthorized).Add("token", "token invalid")
+		return nil, userErr
 	}
 
 	article, articleErr := models.GetArticle(slug)
@@ -167,14 +177,13 @@ func UnfavoriteArticle(slug string, tokenString string) (*ArticleResponse, *api_
 		return nil, api_errors.NewError(http.StatusInternalServerError).Add("article", articleErr.Error())
 	}
 
-	return GetArticle(slug, tokenString)
+	return GetArticle(slug, actor)
 }
 
-func DeleteArticle(slug string, tokenString string) *api_errors.E {
-	email, _ := auth.GetEmailFromTokenString(tokenString)
-	user, userErr := models.GetUser(email)
+func DeleteArticle(slug string, actor *Actor) *api_errors.E {
+	user, userErr := actor.user(ScopeArticlesWrite)
 	if userErr != nil {
-		return api_errors.NewError(http.StatusUnauthorized).Add("token", "token invalid")
+		return userErr
 	}
 
 	article, articleErr := models.GetArticle(slug)
@@ -182,8 +191,9 @@ func DeleteArticle(slug string, tokenString string) *api_errors.E {
 		return api_errors.NewError(http.StatusNotFound).Add("slug", articleErr.Error())
 	}
 
-	if article.AuthorID != user.ID {
-		return api_errors.NewError(http.StatusForbidden).Add("token", "Cannot delete articles of other users")
+	authErr := authorize(user, article.AuthorID, PermissionDeleteAnyArticle, "Cannot delete articles of other users")
+	if authErr != nil {
+		return authErr
 	}
 
 	err := models.DeleteArticle(article.ID)
@@ -217,15 +227,10 @@ func isStrSlice(v interface{}) bool {
 	}
 }
 
-func UpdateArticle(slug string, updateData map[string]interface{}, tokenString string) (*ArticleResponse, *api_errors.E) {
-	email, emErr := auth.GetEmailFromTokenString(tokenString)
-	if emErr != nil {
-		return nil, api_errors.NewError(http.StatusUnauthorized).Add("token", "invalid token")
-	}
-
-	user, uErr := models.GetUser(email)
+func UpdateArticle(slug string, updateData map[string]interface{}, actor *Actor) (*ArticleResponse, *api_errors.E) {
+	user, uErr := actor.user(ScopeArticlesWrite)
 	if uErr != nil {
-		return nil, api_errors.NewError(http.StatusNotFound).Add("user", "user not found")
+		return nil, uErr
 	}
 
 	article, articleErr := models.GetArticle(slug)
@@ -233,8 +238,9 @@ func UpdateArticle(slug string, updateData map[string]interface{}, tokenString s
 		return nil, api_errors.NewError(http.StatusNotFound).Add("slug", articleErr.Error())
 	}
 
-	if article.AuthorID != user.ID {
-		return nil, api_errors.NewError(http.StatusForbidden).Add("token", "Cannot update articles of other users")
+	authErr := authorize(user, article.AuthorID, PermissionUpdateAnyArticle, "Cannot update articles of other users")
+	if authErr != nil {
+		return nil, authErr
 	}
 	update := ArticleCreate{}
 	var slugUpdate string = slug
@@ -259,14 +265,15 @@ func UpdateArticle(slug string, updateData map[string]interface{}, tokenString s
 		Title:       update.Title,
 		Body:        update.Body,
 		Description: update.Description,
-		AuthorID:    user.ID,
-		Slug:        slugUpdate,
+		// moderators edit articles of others, the author stays the same
+		AuthorID: article.AuthorID,
+		Slug:     slugUpdate,
 	}, tagListUpdate)
 	if err != nil {
 		return nil, api_errors.NewError(http.StatusUnprocessableEntity).Add("article", err.Error())
 	}
 
-	return articleToResponse(result, tokenString)
+	return articleToResponse(result, actor)
 }
 
 func articlesListToResponse(list []models.ArticlesList, userID uint) *[]ArticleResponse {
@@ -281,7 +288,7 @@ func articlesListToResponse(list []models.ArticlesList, userID uint) *[]ArticleR
 				Description:    el.Description,
 				Body:           el.Body,
 				TagList:        []string{},
-				CreatedAt:      formatTime(el.CreatedAt),
+				CreatedAt:      formatTime(el.Article.CreatedAt),
 				UpdatedAt:      formatTime(el.UpdatedAt),
 				Favorited:      false,
 				FavoritesCount: 0,
@@ -311,7 +318,7 @@ func articlesListToResponse(list []models.ArticlesList, userID uint) *[]ArticleR
 
 }
 
-func ListArticles(tag *string, authorUsername *string, favoriteByUsername *string, limit uint, offset uint, tokenString string) (*[]ArticleResponse, uint, *api_errors.E) {
+func ListArticles(tag *string, authorUsername *string, favoriteByUsername *string, limit uint, offset uint, actor *Actor) (*[]ArticleResponse, uint, *api_errors.E) {
 	tagFilter := ""
 	var authorID uint = 0
 	var favoredById uint = 0
@@ -341,12 +348,8 @@ func ListArticles(tag *string, authorUsername *string, favoriteByUsername *strin
 		favoredById = favored.ID
 	}
 
-	if tokenString != "" {
-		email, _ := auth.GetEmailFromTokenString(tokenString)
-		user, uErr := models.GetUser(email)
-		if uErr == nil {
-			userID = user.ID
-		}
+	if user := viewer(actor); user != nil {
+		userID = user.ID
 	}
 
 	list, count, listErr := models.ListArticles(tagFilter, authorID, favoredById, limit, offset, userID)
@@ -358,15 +361,14 @@ func ListArticles(tag *string, authorUsername *string, favoriteByUsername *strin
 
 }
 
-func FeedArticles(limit uint, offset uint, tokenString string) (*[]ArticleResponse, uint, *api_errors.E) {
+func FeedArticles(limit uint, offset uint, actor *Actor) (*[]ArticleResponse, uint, *api_errors.E) {
 	if limit == 0 {
 		limit = 20
 	}
 
-	email, _ := auth.GetEmailFromTokenString(tokenString)
-	user, uErr := models.GetUser(email)
+	user, uErr := actor.user(ScopeRead)
 	if uErr != nil {
-		return nil, 0, api_errors.NewError(http.StatusUnauthorized).Add("token", "token invalid")
+		return nil, 0, uErr
 	}
 
 	result, count, err := models.FeedArticles(limit, offset, user.ID)
@@ -389,31 +391,35 @@ func GetAllTags() (*[]string, *api_errors.E) {
 	return &result, nil
 }
 
-func CreateComment(body string, articleSlug string, tokenString string) (*CommentResponse, *api_errors.E) {
-	email, mailErr := auth.GetEmailFromTokenString(tokenString)
-	if mailErr != nil {
-		return nil, api_errors.NewError(http.StatusUnauthorized).Add("token", "token invalid")
+func CreateComment(body string, articleSlug string, actor *Actor) (*CommentResponse, *api_errors.E) {
+	user, uErr := actor.user(ScopeCommentsWrite)
+	if uErr != nil {
+		return nil, uErr
 	}
 
-	user, uErr := models.GetUser(email)
-	if uErr != nil {
-		return nil, api_errors.NewError(http.StatusUnauthorized).Add("token", "token invalid")
+	verifiedErr := requireVerifiedEmail(user, RestrictComments)
+	if verifiedErr != nil {
+		return nil, verifiedErr
 	}
 
-	profile, pErr := GetProfile(user.Username, tokenString)
+	profile, pErr := GetProfile(user.Username, actor)
 	if pErr != nil {
 		return nil, api_errors.NewError(http.StatusNotFound).Add("author", "author not found")
 	}
 
-	article, aErr := models.GetArticle(articleSlug)
+	article, aErr := visibleArticle(articleSlug, actor)
 	if aErr != nil {
 		return nil, api_errors.NewError(http.StatusNotFound).Add("article", "article not found")
 	}
+	if models.IsBlocked(article.AuthorID, user.ID) {
+		return nil, api_errors.NewError(http.StatusForbidden).Add("article", "author does not accept your comments")
+	}
 
 	result, err := models.CreateComment(user.ID, article.ID, body)
 	if err != nil {
 		return nil, api_errors.NewError(http.StatusInternalServerError).Add("comment", err.Error())
 	}
+	notify(article.AuthorID, models.NotificationComment, &article.ID, user.ID)
 
 	return &CommentResponse{
 		ID:        result.ID,
@@ -424,23 +430,27 @@ func CreateComment(body string, articleSlug string, tokenString string) (*Commen
 	}, nil
 }
 
-func GetCommentsForArticle(slug string, tokenString string) (*[]CommentResponse, *api_errors.E) {
-	article, aErr := models.GetArticle(slug)
+func GetCommentsForArticle(slug string, actor *Actor) (*[]CommentResponse, *api_errors.E) {
+	article, aErr := visibleArticle(slug, actor)
 	if aErr != nil {
 		return nil, api_errors.NewError(http.StatusNotFound).Add("article", "article not found")
 	}
 
-	comments, cErr := models.GetCommentsForArticle(article.ID)
+	var viewerID uint = 0
+	if v := viewer(actor); v != nil {
+		viewerID = v.ID
+	}
+	comments, cErr := models.GetCommentsForArticle(article.ID, viewerID)
 	if cErr != nil {
 		return nil, api_errors.NewError(http.StatusNotFound).Add("article", "article not found")
 	}
 
 	result := []CommentResponse{}
 	for _, c := range *comments {
-		profile, _ := GetProfile(c.User.Username, tokenString)
+		profile, _ := GetProfile(c.User.Username, actor)
 		result = append(result, CommentResponse{
 			ID:        c.ID,
-			CreatedAt: formatTime(c.CreatedAt),
+			CreatedAt: formatTime(c.Comment.CreatedAt),
 			UpdatedAt: formatTime(c.UpdatedAt),
 			Body:      c.Body,
 			Author:    *profile,
@@ -449,15 +459,10 @@ func GetCommentsForArticle(slug string, tokenString string) (*[]CommentResponse,
 	return &result, nil
 }
 
-func DeleteComment(commentID uint, tokenString string) *api_errors.E {
-	email, mailErr := auth.GetEmailFromTokenString(tokenString)
-	if mailErr != nil {
-		return api_errors.NewError(http.StatusUnauthorized).Add("token", "token invalid")
-	}
-
-	user, uErr := models.GetUser(email)
+func DeleteComment(commentID uint, actor *Actor) *api_errors.E {
+	user, uErr := actor.user(ScopeCommentsWrite)
 	if uErr != nil {
-		return api_errors.NewError(http.StatusUnauthorized).Add("token", "token invalid")
+		return uErr
 	}
 
 	comment, cErr := models.GetComment(commentID)
@@ -465,8 +470,9 @@ func DeleteComment(commentID uint, tokenString string) *api_errors.E {
 		return nil
 	}
 
-	if comment.AuthorID != user.ID {
-		return api_errors.NewError(http.StatusForbidden).Add("author", "can not delete other people's articles")
+	authErr := authorize(user, comment.AuthorID, PermissionDeleteAnyComment, "can not delete other people's comments")
+	if authErr != nil {
+		return authErr
 	}
 
 	err := models.DeleteComment(commentID)
@@ -10,10 +10,10 @@ func TestCreateArticle(t *testing.T) {
 	initDb()
 	defer closeDb()
 	createUser(t)
-	userResponse, _ := domain.SignIn(userSignIn)
+	userResponse, _ := domain.SignIn(userSignIn, testClient)
 	tokenString := userResponse.Token
 
-	result, err := domain.CreateArticle(articleCreate, tokenString)
+	result, err := domain.CreateArticle(articleCreate, identify(tokenString))
 	defer destroyArticle()
 
 	if err != nil {
@@ -33,7 +33,7 @@ func TestGetArticle(t *testing.T) {
 	createArticle(t)
 	defer destroyArticle()
 
-	result, err := domain.GetArticle(domain.SlugFromTitle(articleCreate.Title), "")
+	result, err := domain.GetArticle(domain.SlugFromTitle(articleCreate.Title), nil)
 	if err != nil {
 		t.Fatalf("could not get article: %s", err.Error())
 	}
@@ -48,10 +48,10 @@ func TestFavoriteArticle(t *testing.T) {
 	defer closeDb()
 	createArticle(t)
 	defer destroyArticle()
-	userResponse, _ := domain.SignIn(userSignIn)
+	userResponse, _ := domain.SignIn(userSignIn, testClient)
 	tokenString := userResponse.Token
 
-	result, err := domain.FavoriteArticle(domain.SlugFromTitle(articleCreate.Title), tokenString)
+	result, err := domain.FavoriteArticle(domain.SlugFromTitle(articleCreate.Title), identify(tokenString))
 	if err != nil {
 		t.Fatalf("could not favorite article: %s", err.Error())
 	}
@@ -60,7 +60,7 @@ func TestFavoriteArticle(t *testing.T) {
 		t.Fatalf("could not favorite an article")
 	}
 
-	unfavor, err2 := domain.UnfavoriteArticle(domain.SlugFromTitle(articleCreate.Title), tokenString)
+	unfavor, err2 := domain.UnfavoriteArticle(domain.SlugFromTitle(articleCreate.Title), identify(tokenString))
 	if err2 != nil {
 		t.Fatalf("could not unfavorite article: %s", err.Error())
 	}
@@ -75,20 +75,20 @@ func TestDeleteArticle(t *testing.T) {
 	defer closeDb()
 	createArticle(t)
 	defer destroyArticle()
-	userResponse, _ := domain.SignIn(userSignIn)
+	userResponse, _ := domain.SignIn(userSignIn, testClient)
 	tokenString := userResponse.Token
 
-	_, aErr := domain.GetArticle(domain.SlugFromTitle(articleCreate.Title), "")
+	_, aErr := domain.GetArticle(domain.SlugFromTitle(articleCreate.Title), nil)
 	if aErr != nil {
 		t.Fatalf("could not get article: %s", aErr.Error())
 	}
 
-	err := domain.DeleteArticle(domain.SlugFromTitle(articleCreate.Title), tokenString)
+	err := domain.DeleteArticle(domain.SlugFromTitle(articleCreate.Title), identify(tokenString))
 	if err != nil {
 		t.Fatalf("could not delete an article")
 	}
 
-	result, rErr := domain.GetArticle(domain.SlugFromTitle(articleCreate.Title), "")
+	result, rErr := domain.GetArticle(domain.SlugFromTitle(articleCreate.Title), nil)
 	if result != nil || rErr == nil {
 		t.Fatalf("deleted article returned")
 	}
@@ -99,7 +99,7 @@ func TestUpdateArticle(t *testing.T) {
 	defer closeDb()
 	createArticle(t)
 	defer destroyArticle()
-	userResponse, _ := domain.SignIn(userSignIn)
+	userResponse, _ := domain.SignIn(userSignIn, testClient)
 	tokenString := userResponse.Token
 	update := map[string]interface{}{
 		"title":       "newtitle",
@@ -108,7 +108,7 @@ func TestUpdateArticle(t *testing.T) {
 		"description": "",
 	}
 
-	result, err := domain.UpdateArticle(domain.SlugFromTitle(articleCreate.Title), update, tokenString)
+	result, err := domain.UpdateArticle(domain.SlugFromTitle(articleCreate.Title), update, identify(tokenString))
 	defer func() {
 		DB.Get().Exec("DELETE FROM articles WHERE title = 'newtitle'")
 	}()
@@ -126,31 +126,31 @@ func TestUpdateArticle(t *testing.T) {
 func setupListArticles(t *testing.T) string /* token */ {
 	initDb()
 	createUser(t)
-	userResponse, _ := domain.SignIn(userSignIn)
+	userResponse, _ := domain.SignIn(userSignIn, testClient)
 	tokenString := userResponse.Token
 	domain.CreateArticle(domain.ArticleCreate{
 		Title:       "t1",
 		Description: "d1",
 		Body:        "b1",
 		TagList:     []string{"t0", "t1"},
-	}, tokenString)
+	}, identify(tokenString))
 
 	domain.CreateArticle(domain.ArticleCreate{
 		Title:       "t2",
 		Description: "d2",
 		Body:        "b2",
 		TagList:     []string{"t1"},
-	}, tokenString)
+	}, identify(tokenString))
 
 	domain.CreateArticle(domain.ArticleCreate{
 		Title:       "t3",
 		Description: "d3",
 		Body:        "b3",
 		TagList:     []string{"t2"},
-	}, tokenString)
+	}, identify(tokenString))
 
-	domain.FavoriteArticle("t2", tokenString)
-	domain.FollowUser(userResponse.Username, tokenString)
+	domain.FavoriteArticle("t2", identify(tokenString))
+	domain.FollowUser(userResponse.Username, identify(tokenString))
 
 	return tokenString
 }
@@ -165,7 +165,7 @@ func TestListArticlesByTag(t *testing.T) {
 	defer tearDownListArticles()
 
 	tag := "t1"
-	result, count, err := domain.ListArticles(&tag, nil, nil, 0, 0, token)
+	result, count, err := domain.ListArticles(&tag, nil, nil, 0, 0, identify(token))
 
 	if err != nil {
 		t.Fatalf("could not list articles: %s", err)
@@ -189,7 +189,7 @@ func TestListArticlesByFav(t *testing.T) {
 	defer tearDownListArticles()
 
 	userName := userCreate.Username
-	result, count, err := domain.ListArticles(nil, nil, &userName, 0, 0, token)
+	result, count, err := domain.ListArticles(nil, nil, &userName, 0, 0, identify(token))
 
 	if err != nil {
 		t.Fatalf("could not list articles: %s", err)
@@ -210,7 +210,7 @@ func TestListArticlesByTagAndFav(t *testing.T) {
 
 	userName := userCreate.Username
 	tag := "t3"
-	result, count, err := domain.ListArticles(&tag, nil, &userName, 0, 0, token)
+	result, count, err := domain.ListArticles(&tag, nil, &userName, 0, 0, identify(token))
 
 	if err != nil {
 		t.Fatalf("could not list articles: %s", err)
@@ -230,7 +230,7 @@ func TestListArticlesByAuthor(t *testing.T) {
 	defer tearDownListArticles()
 
 	userName := userCreate.Username
-	result, count, err := domain.ListArticles(nil, &userName, nil, 0, 0, token)
+	result, count, err := domain.ListArticles(nil, &userName, nil, 0, 0, identify(token))
 
 	if err != nil {
 		t.Fatalf("could not list articles: %s", err)
@@ -249,7 +249,7 @@ func TestListAllArticles(t *testing.T) {
 	token := setupListArticles(t)
 	defer tearDownListArticles()
 
-	result, count, err := domain.ListArticles(nil, nil, nil, 0, 0, token)
+	result, count, err := domain.ListArticles(nil, nil, nil, 0, 0, identify(token))
 
 	if err != nil {
 		t.Fatalf("could not list articles: %s", err)
@@ -268,7 +268,7 @@ func TestFeedArticles(t *testing.T) {
 	token := setupListArticles(t)
 	defer tearDownListArticles()
 
-	result, count, err := domain.FeedArticles(0, 0, token)
+	result, count, err := domain.FeedArticles(0, 0, identify(token))
 
 	if err != nil {
 		t.Fatalf("could not feed articles: %s", err)
@@ -302,7 +302,7 @@ func TestCreateComment(t *testing.T) {
 	token := setupListArticles(t)
 	defer tearDownListArticles()
 
-	result, err := domain.CreateComment("Hello comment", "t2", token)
+	result, err := domain.CreateComment("Hello comment", "t2", identify(token))
 
 	if err != nil {
 		t.Fatalf("could not get create comment: %s", err)
@@ -317,9 +317,9 @@ func TestGetAllComments(t *testing.T) {
 	token := setupListArticles(t)
 	defer tearDownListArticles()
 
-	domain.CreateComment("Hello comment", "t2", token)
-	domain.CreateComment("Hello comment 2", "t2", token)
-	result, err := domain.GetCommentsForArticle("t2", token)
+	domain.CreateComment("Hello comment", "t2", identify(token))
+	domain.CreateComment("Hello comment 2", "t2", identify(token))
+	result, err := domain.GetCommentsForArticle("t2", identify(token))
 
 	if err != nil {
 		t.Fatalf("could not get get articles: %s", err)
@@ -0,0 +1,173 @@
+package domain
+
+import (
+	"../api_errors"
+	"../models"
+	"log"
+	"net/http"
+)
+
+// Types of audit events
+const (
+	AuditSignUp            = "sign_up"
+	AuditSignIn            = "sign_in"
+	AuditSignOut           = "sign_out"
+	AuditPasswordChange    = "password_change"
+	AuditPasswordReset     = "password_reset"
+	AuditEmailChange       = "email_change"
+	AuditEmailVerify       = "email_verify"
+	AuditAccountUnlock     = "account_unlock"
+	AuditTwoFactorEnable   = "two_factor_enable"
+	AuditTwoFactorDisable  = "two_factor_disable"
+	AuditSessionRevoke     = "session_revoke"
+	AuditAccessTokenCreate = "access_token_create"
+	AuditAccessTokenDelete = "access_token_delete"
+	AuditRoleChange        = "role_change"
+	AuditFollow            = "follow"
+	AuditUnfollow          = "unfollow"
+	AuditAccountDelete     = "account_delete"
+	AuditBlock             = "block"
+	AuditUnblock           = "unblock"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	// sign in waits for the second factor
+	OutcomePending = "pending"
+)
+
+type AuditEventResponse struct {
+	ID        uint   `json:"id"`
+	CreatedAt string `json:"createdAt"`
+	Type      string `json:"type"`
+	UserID    *uint  `json:"userId"`
+	ActorID   *uint  `json:"actorId"`
+	Email     string `json:"email"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"userAgent"`
+	Outcome   string `json:"outcome"`
+	Details   string `json:"details"`
+}
+
+type AuditQuery struct {
+	Username string
+	models.AuditFilter
+	Limit  uint
+	Offset uint
+}
+
+func userID(user *models.User) *uint {
+	if user == nil {
+		return nil
+	}
+	id := user.ID
+	return &id
+}
+
+// Audit log failures are logged and do not fail the action that is audited
+func audit(event models.AuditEvent) {
+	event.UserAgent = truncate(event.UserAgent, 512)
+	event.Details = truncate(event.Details, 1024)
+	err := models.CreateAuditEvent(&event)
+	if err != nil {
+		log.Printf("could not write %s audit event: %s", event.Type, err)
+	}
+}
+
+// Event from an anonymous request, like sign in
+func auditClient(eventType string, client Client, user *models.User, email string, outcome string, details string) {
+	audit(models.AuditEvent{
+		Type:      eventType,
+		UserID:    userID(user),
+		ActorID:   userID(user),
+		Email:     email,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Outcome:   outcome,
+		Details:   details,
+	})
+}
+
+// Successful action of a signed in actor on user, which is often the actor themselves
+func auditActor(eventType string, actor *Actor, user *models.User, details string) {
+	audit(models.AuditEvent{
+		Type:      eventType,
+		UserID:    userID(user),
+		ActorID:   userID(actor.User),
+		Email:     user.Email,
+		IP:        actor.Client.IP,
+		UserAgent: actor.Client.UserAgent,
+		Outcome:   OutcomeSuccess,
+		Details:   details,
+	})
+}
+
+func auditEventToResponse(e *models.AuditEvent) AuditEventResponse {
+	return AuditEventResponse{
+		ID:        e.ID,
+		CreatedAt: formatTime(e.CreatedAt),
+		Type:      e.Type,
+		UserID:    e.UserID,
+		ActorID:   e.ActorID,
+		Email:     e.Email,
+		IP:        e.IP,
+		UserAgent: e.UserAgent,
+		Outcome:   e.Outcome,
+		Details:   e.Details,
+	}
+}
+
+func auditFilter(q AuditQuery, actor *Actor) (models.AuditFilter, *api_errors.E) {
+	user, userErr := actor.user(ScopeSession)
+	if userErr != nil {
+		return q.AuditFilter, userErr
+	}
+	if !can(user, PermissionViewAuditLog) {
+		return q.AuditFilter, api_errors.NewError(http.StatusForbidden).Add("token", "only admins can read audit log")
+	}
+	filter := q.AuditFilter
+	if q.Username != "" {
+		subject, err := models.GetUserByUsername(q.Username)
+		if err != nil {
+			return filter, api_errors.NewError(http.StatusNotFound).Add("user", "user not found")
+		}
+		filter.UserID = &subject.ID
+	}
+	return filter, nil
+}
+
+// Newest events first
+func ListAuditEvents(q AuditQuery, actor *Actor) (*[]AuditEventResponse, uint, *api_errors.E) {
+	filter, filterErr := auditFilter(q, actor)
+	if filterErr != nil {
+		return nil, 0, filterErr
+	}
+	if q.Limit == 0 {
+		q.Limit = 100
+	}
+	events, count, err := models.ListAuditEvents(filter, q.Limit, q.Offset)
+	if err != nil {
+		return nil, 0, api_errors.NewError(http.StatusInternalServerError).Add("events", "could not get audit events")
+	}
+	result := []AuditEventResponse{}
+	for i := range *events {
+		result = append(result, auditEventToResponse(&(*events)[i]))
+	}
+	return &result, count, nil
+}
+
+// Passes every matching event to write, oldest first. Limit and offset are ignored
+func ExportAuditEvents(q AuditQuery, actor *Actor, write func(event AuditEventResponse) error) *api_errors.E {
+	filter, filterErr := auditFilter(q, actor)
+	if filterErr != nil {
+		return filterErr
+	}
+	err := models.EachAuditEvent(filter, func(event *models.AuditEvent) error {
+		return write(auditEventToResponse(event))
+	})
+	if err != nil {
+		return api_errors.NewError(http.StatusInternalServerError).Add("events", "could not export audit events")
+	}
+	return nil
+}
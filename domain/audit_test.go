@@ -0,0 +1,55 @@
+package domain_test
+
+import (
+	"../domain"
+	"../models"
+	"testing"
+)
+
+func TestSignInWritesAuditEvents(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createUser(t)
+	defer destroyUser()
+	admin, _ := domain.CreateUser(moderatorCreate, testClient)
+	defer destroyModerator()
+
+	wrong := domain.UserSignIn{Email: userSignIn.Email, Password: "wrongpassword"}
+	_, _ = domain.SignIn(wrong, testClient)
+	user, signInErr := domain.SignIn(userSignIn, testClient)
+	if signInErr != nil {
+		t.Fatalf("could not sign in: %s", signInErr)
+	}
+
+	q := domain.AuditQuery{Username: userCreate.Username}
+	q.Type = domain.AuditSignIn
+	_, _, err := domain.ListAuditEvents(q, identify(user.Token))
+	if err == nil {
+		t.Fatalf("user without admin role read audit log")
+	}
+
+	stored, _ := models.GetUser(moderatorCreate.Email)
+	models.SetUserRole(stored.ID, models.RoleAdmin)
+	events, count, err := domain.ListAuditEvents(q, identify(admin.Token))
+	if err != nil {
+		t.Fatalf("admin could not read audit log: %s", err)
+	}
+	if count != 2 {
+		t.Fatalf("expected 2 sign in events, got %d", count)
+	}
+	if (*events)[0].Outcome != domain.OutcomeSuccess || (*events)[1].Outcome != domain.OutcomeFailure {
+		t.Fatalf("events are not newest first: %v", *events)
+	}
+
+	exported := []domain.AuditEventResponse{}
+	exportErr := domain.ExportAuditEvents(q, identify(admin.Token), func(event domain.AuditEventResponse) error {
+		exported = append(exported, event)
+		return nil
+	})
+	if exportErr != nil {
+		t.Fatalf("could not export audit log: %s", exportErr)
+	}
+	if len(exported) != 2 || exported[0].Outcome != domain.OutcomeFailure {
+		t.Fatalf("export is not oldest first: %v", exported)
+	}
+}
@@ -0,0 +1,151 @@
+package domain
+
+import (
+	"../api_errors"
+	"../auth"
+	"../models"
+	"../storage"
+	"../utils"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	MaxAvatarBytes = 5 << 20
+	// larger images are refused before decoding, a small file can decode to a huge bitmap
+	maxAvatarSide = 4096
+)
+
+// Square variants stored for every avatar, largest first. Image points to the first one
+var avatarSizes = []int{256, 128, 64}
+
+var avatarTypes = map[string]bool{"image/jpeg": true, "image/png": true, "image/gif": true}
+
+func avatarKey(userID uint, id string, size int) string {
+	return fmt.Sprintf("avatars/%d/%s-%d.png", userID, id, size)
+}
+
+func imageURL(key string) string {
+	return utils.APIURL() + "/images/" + key
+}
+
+// Replaces the avatar of actor with data, a jpeg, png or gif image
+func UploadAvatar(data []byte, actor *Actor) (*UserResponse, *api_errors.E) {
+	user, userErr := actor.user(ScopeSession)
+	if userErr != nil {
+		return nil, userErr
+	}
+	invalid := api_errors.NewValidationError()
+	if len(data) > MaxAvatarBytes {
+		return nil, invalid.Add("image", fmt.Sprintf("is too large (maximum is %d MB)", MaxAvatarBytes>>20))
+	}
+	if !avatarTypes[http.DetectContentType(data)] {
+		return nil, invalid.Add("image", "must be a jpeg, png or gif image")
+	}
+	config, _, configErr := image.DecodeConfig(bytes.NewReader(data))
+	if configErr != nil {
+		return nil, invalid.Add("image", "could not be read")
+	}
+	if config.Width > maxAvatarSide || config.Height > maxAvatarSide {
+		return nil, invalid.Add("image", fmt.Sprintf("is too large (maximum is %dx%d pixels)", maxAvatarSide, maxAvatarSide))
+	}
+	src, _, decodeErr := image.Decode(bytes.NewReader(data))
+	if decodeErr != nil {
+		return nil, invalid.Add("image", "could not be read")
+	}
+
+	id := auth.RandomToken(9)
+	variant := src
+	for _, size := range avatarSizes {
+		// every variant is made from the previous one, so only the first reads the whole upload
+		variant = resizeSquare(variant, size)
+		var buf bytes.Buffer
+		err := png.Encode(&buf, variant)
+		if err == nil {
+			err = storage.Put(avatarKey(user.ID, id, size), buf.Bytes())
+		}
+		if err != nil {
+			log.Printf("could not store avatar: %s", err)
+			deleteAvatarFiles(user.ID, id)
+			return nil, api_errors.NewError(http.StatusInternalServerError).Add("image", "could not store image")
+		}
+	}
+
+	old := user.Image
+	url := imageURL(avatarKey(user.ID, id, avatarSizes[0]))
+	err := models.SetUserImage(user.ID, &url)
+	if err != nil {
+		deleteAvatarFiles(user.ID, id)
+		return nil, api_errors.NewError(http.StatusInternalServerError).Add("image", "could not update user")
+	}
+	user.Image = &url
+	deleteAvatar(user.ID, old)
+
+	response := userToResponse(user, actor.Token, "")
+	return &response, nil
+}
+
+// Removes stored variants when image is an avatar uploaded by userID, urls of other hosts are left alone
+func deleteAvatar(userID uint, image *string) {
+	if image == nil {
+		return
+	}
+	prefix := imageURL(fmt.Sprintf("avatars/%d/", userID))
+	suffix := fmt.Sprintf("-%d.png", avatarSizes[0])
+	if !strings.HasPrefix(*image, prefix) || !strings.HasSuffix(*image, suffix) {
+		return
+	}
+	deleteAvatarFiles(userID, strings.TrimSuffix(strings.TrimPrefix(*image, prefix), suffix))
+}
+
+func deleteAvatarFiles(userID uint, id string) {
+	for _, size := range avatarSizes {
+		err := storage.Delete(avatarKey(userID, id, size))
+		if err != nil {
+			log.Printf("could not delete avatar: %s", err)
+		}
+	}
+}
+
+// Center square of src scaled to size x size, every pixel averages the source pixels it covers
+func resizeSquare(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		sy0, sy1 := y0+y*side/size, y0+(y+1)*side/size
+		if sy1 <= sy0 {
+			sy1 = sy0 + 1
+		}
+		for x := 0; x < size; x++ {
+			sx0, sx1 := x0+x*side/size, x0+(x+1)*side/size
+			if sx1 <= sx0 {
+				sx1 = sx0 + 1
+			}
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(pr), g+uint64(pg), bl+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
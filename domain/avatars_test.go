@@ -0,0 +1,58 @@
+package domain_test
+
+import (
+	"../domain"
+	"../storage"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestUploadAvatarStoresVariants(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createUser(t)
+	defer destroyUser()
+	storage.SetStorage(storage.NewLocalStorage(t.TempDir()))
+	user, _ := domain.SignIn(userSignIn, testClient)
+
+	_, err := domain.UploadAvatar([]byte("not an image"), identify(user.Token))
+	if err == nil {
+		t.Fatalf("uploaded text as avatar")
+	}
+
+	src := image.NewRGBA(image.Rect(0, 0, 600, 400))
+	for x := 0; x < 600; x++ {
+		for y := 0; y < 400; y++ {
+			src.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, src)
+	updated, err := domain.UploadAvatar(buf.Bytes(), identify(user.Token))
+	if err != nil {
+		t.Fatalf("could not upload avatar: %s", err)
+	}
+	if updated.Image == nil || !strings.Contains(*updated.Image, "/images/avatars/") {
+		t.Fatalf("image is not a served url: %v", updated.Image)
+	}
+
+	key := (*updated.Image)[strings.Index(*updated.Image, "/images/")+len("/images/"):]
+	for _, size := range []int{256, 128, 64} {
+		data, getErr := storage.Get(strings.Replace(key, "-256.png", fmt.Sprintf("-%d.png", size), 1))
+		if getErr != nil {
+			t.Fatalf("variant %d is not stored: %s", size, getErr)
+		}
+		variant, decodeErr := png.Decode(bytes.NewReader(data))
+		if decodeErr != nil {
+			t.Fatalf("variant %d is not a png: %s", size, decodeErr)
+		}
+		if variant.Bounds().Dx() != size || variant.Bounds().Dy() != size {
+			t.Fatalf("variant %d is %v", size, variant.Bounds())
+		}
+	}
+}
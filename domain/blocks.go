@@ -0,0 +1,113 @@
+package domain
+
+import (
+	"../api_errors"
+	"../models"
+	"fmt"
+	"net/http"
+)
+
+// Target of a block or mute by actor, who can not block or mute themselves
+func relationTarget(username string, actor *Actor, verb string) (*models.User, *models.User, *api_errors.E) {
+	user, userErr := actor.user(ScopeProfilesWrite)
+	if userErr != nil {
+		return nil, nil, userErr
+	}
+	target, targetErr := models.GetUserByUsername(username)
+	if targetErr != nil {
+		return nil, nil, api_errors.NewError(http.StatusNotFound).Add("username", fmt.Sprintf("could not find user with this username: %s", username))
+	}
+	if target.ID == user.ID {
+		return nil, nil, api_errors.NewValidationError().Add("username", fmt.Sprintf("can not %s yourself", verb))
+	}
+	return user, target, nil
+}
+
+func followProfilesToResponse(rows *[]models.FollowProfile) *[]Profile {
+	result := []Profile{}
+	for _, row := range *rows {
+		result = append(result, Profile{
+			Username:  row.Username,
+			Bio:       row.Bio,
+			Image:     row.Image,
+			Following: row.Following,
+		})
+	}
+	return &result
+}
+
+// Blocking also ends follows between the two users
+func BlockUser(username string, actor *Actor) (*Profile, *api_errors.E) {
+	user, target, err := relationTarget(username, actor, "block")
+	if err != nil {
+		return nil, err
+	}
+	blockErr := models.AddBlock(user.ID, target.ID)
+	if blockErr != nil {
+		return nil, api_errors.NewError(http.StatusInternalServerError).Add("body", "could not block user")
+	}
+	auditActor(AuditBlock, actor, user, "blocked "+target.Username)
+	return &Profile{Username: target.Username, Bio: target.Bio, Image: target.Image, Following: false}, nil
+}
+
+func UnblockUser(username string, actor *Actor) (*Profile, *api_errors.E) {
+	user, target, err := relationTarget(username, actor, "unblock")
+	if err != nil {
+		return nil, err
+	}
+	unblockErr := models.RemoveBlock(user.ID, target.ID)
+	if unblockErr != nil {
+		return nil, api_errors.NewError(http.StatusInternalServerError).Add("body", "could not unblock user")
+	}
+	auditActor(AuditUnblock, actor, user, "unblocked "+target.Username)
+	return &Profile{Username: target.Username, Bio: target.Bio, Image: target.Image, Following: false}, nil
+}
+
+func ListBlocks(actor *Actor) (*[]Profile, *api_errors.E) {
+	user, userErr := actor.user(ScopeRead)
+	if userErr != nil {
+		return nil, userErr
+	}
+	rows, err := models.ListBlocked(user.ID)
+	if err != nil {
+		return nil, api_errors.NewError(http.StatusInternalServerError).Add("profiles", "could not get blocked users")
+	}
+	return followProfilesToResponse(rows), nil
+}
+
+// Muted users are not told, their content is only hidden from actor
+func MuteUser(username string, actor *Actor) (*Profile, *api_errors.E) {
+	user, target, err := relationTarget(username, actor, "mute")
+	if err != nil {
+		return nil, err
+	}
+	muteErr := models.AddMute(user.ID, target.ID)
+	if muteErr != nil {
+		return nil, api_errors.NewError(http.StatusInternalServerError).Add("body", "could not mute user")
+	}
+	return &Profile{Username: target.Username, Bio: target.Bio, Image: target.Image, Following: models.IsFollowing(user.ID, target.ID)}, nil
+}
+
+func UnmuteUser(username string, actor *Actor) (*Profile, *api_errors.E) {
+	user, target, err := relationTarget(username, actor, "unmute")
+	if err != nil {
+		return nil, err
+	}
+	unmuteErr := models.RemoveMute(user.ID, target.ID)
+	if unmuteErr != nil {
+		return nil, api_errors.NewError(http.StatusInternalServerError).Add("body", "could not unmute user")
+	}
+	return &Profile{Username: target.Username, Bio: target.Bio, Image: target.Image, Following: models.IsFollowing(user.ID, target.ID)}, nil
+}
+
+func ListMutes(actor *Actor) (*[]Profile, *api_errors.E) {
+	user, userErr := actor.user(ScopeRead)
+	if userErr != nil {
+		return nil, userErr
+	}
+	rows, err := models.ListMuted(user.ID)
+	if err != nil {
+		return nil, api_errors.NewError(http.StatusInternalServerError).Add("profiles", "could not get muted users")
+	}
+	return followProfilesToResponse(rows), nil
+}
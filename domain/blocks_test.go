@@ -0,0 +1,192 @@
+package domain_test
+
+import (
+	"../DB"
+	"../domain"
+	"fmt"
+	"testing"
+)
+
+func TestBlockedUserCanNotFollowOrComment(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createArticle(t)
+	defer destroyArticle()
+	other, _ := domain.CreateUser(moderatorCreate, testClient)
+	defer destroyModerator()
+	user, _ := domain.SignIn(userSignIn, testClient)
+	defer DB.Get().Exec(fmt.Sprintf("DELETE FROM blocks WHERE blocked_id IN (SELECT id FROM users WHERE email = '%s')", moderatorCreate.Email))
+	slug := domain.SlugFromTitle(articleCreate.Title)
+
+	domain.FollowUser(userCreate.Username, identify(other.Token))
+	_, err := domain.BlockUser(moderatorCreate.Username, identify(user.Token))
+	if err != nil {
+		t.Fatalf("could not block user: %s", err)
+	}
+	followers, _, _ := domain.ListFollowers(userCreate.Username, 0, 0, nil)
+	if len(*followers) != 0 {
+		t.Fatalf("blocked user still follows")
+	}
+	_, err = domain.FollowUser(userCreate.Username, identify(other.Token))
+	if err == nil {
+		t.Fatalf("blocked user could follow")
+	}
+	_, err = domain.CreateComment("Hello", slug, identify(other.Token))
+	if err == nil {
+		t.Fatalf("blocked user could comment")
+	}
+	blocks, _ := domain.ListBlocks(identify(user.Token))
+	if len(*blocks) != 1 || (*blocks)[0].Username != moderatorCreate.Username {
+		t.Fatalf("unexpected blocks: %v", *blocks)
+	}
+
+	_, err = domain.UnblockUser(moderatorCreate.Username, identify(user.Token))
+	if err != nil {
+		t.Fatalf("could not unblock user: %s", err)
+	}
+	_, err = domain.FollowUser(userCreate.Username, identify(other.Token))
+	if err != nil {
+		t.Fatalf("could not follow after unblock: %s", err)
+	}
+}
+
+func TestMutedCommentsAreHidden(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createArticle(t)
+	defer destroyArticle()
+	other, _ := domain.CreateUser(moderatorCreate, testClient)
+	defer destroyModerator()
+	user, _ := domain.SignIn(userSignIn, testClient)
+	defer DB.Get().Exec(fmt.Sprintf("DELETE FROM mutes WHERE muted_id IN (SELECT id FROM users WHERE email = '%s')", moderatorCreate.Email))
+	slug := domain.SlugFromTitle(articleCreate.Title)
+
+	comment, commentErr := domain.CreateComment("Muted comment", slug, identify(other.Token))
+	if commentErr != nil {
+		t.Fatalf("could not comment: %s", commentErr)
+	}
+	defer DB.Get().Exec(fmt.Sprintf("DELETE FROM comments WHERE id = %d", comment.ID))
+
+	_, err := domain.MuteUser(moderatorCreate.Username, identify(user.Token))
+	if err != nil {
+		t.Fatalf("could not mute user: %s", err)
+	}
+	comments, _ := domain.GetCommentsForArticle(slug, identify(user.Token))
+	if len(*comments) != 0 {
+		t.Fatalf("comment of muted user is shown to muter")
+	}
+	comments, _ = domain.GetCommentsForArticle(slug, identify(other.Token))
+	if len(*comments) != 1 {
+		t.Fatalf("muted user does not see own comment")
+	}
+}
+
+func hasArticle(articles *[]domain.ArticleResponse, slug string) bool {
+	for _, a := range *articles {
+		if a.Slug == slug {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMutedAuthorArticlesAreHidden(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createArticle(t)
+	defer destroyArticle()
+	other, _ := domain.CreateUser(moderatorCreate, testClient)
+	defer destroyModerator()
+	defer DB.Get().Exec(fmt.Sprintf("DELETE FROM mutes WHERE muter_id IN (SELECT id FROM users WHERE email = '%s')", moderatorCreate.Email))
+	slug := domain.SlugFromTitle(articleCreate.Title)
+
+	_, err := domain.FollowUser(userCreate.Username, identify(other.Token))
+	if err != nil {
+		t.Fatalf("could not follow: %s", err)
+	}
+	feed, _, _ := domain.FeedArticles(0, 0, identify(other.Token))
+	if !hasArticle(feed, slug) {
+		t.Fatalf("article of followed author is not in feed")
+	}
+
+	_, err = domain.MuteUser(userCreate.Username, identify(other.Token))
+	if err != nil {
+		t.Fatalf("could not mute user: %s", err)
+	}
+	articles, _, _ := domain.ListArticles(nil, nil, nil, 0, 0, identify(other.Token))
+	if hasArticle(articles, slug) {
+		t.Fatalf("article of muted author is listed for muter")
+	}
+	feed, _, _ = domain.FeedArticles(0, 0, identify(other.Token))
+	if hasArticle(feed, slug) {
+		t.Fatalf("article of muted author is in the muter's feed")
+	}
+	articles, _, _ = domain.ListArticles(nil, nil, nil, 0, 0, nil)
+	if !hasArticle(articles, slug) {
+		t.Fatalf("mute hid the article from everybody")
+	}
+}
+
+func TestBlockedAuthorArticlesAreHidden(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createArticle(t)
+	defer destroyArticle()
+	other, _ := domain.CreateUser(moderatorCreate, testClient)
+	defer destroyModerator()
+	user, _ := domain.SignIn(userSignIn, testClient)
+	defer DB.Get().Exec(fmt.Sprintf("DELETE FROM blocks WHERE blocked_id IN (SELECT id FROM users WHERE email = '%s')", moderatorCreate.Email))
+	slug := domain.SlugFromTitle(articleCreate.Title)
+
+	_, err := domain.FollowUser(userCreate.Username, identify(other.Token))
+	if err != nil {
+		t.Fatalf("could not follow: %s", err)
+	}
+	_, err = domain.BlockUser(moderatorCreate.Username, identify(user.Token))
+	if err != nil {
+		t.Fatalf("could not block user: %s", err)
+	}
+	articles, _, _ := domain.ListArticles(nil, nil, nil, 0, 0, identify(other.Token))
+	if hasArticle(articles, slug) {
+		t.Fatalf("article of blocking author is listed for blocked user")
+	}
+	feed, _, _ := domain.FeedArticles(0, 0, identify(other.Token))
+	if hasArticle(feed, slug) {
+		t.Fatalf("article of blocking author is in the blocked user's feed")
+	}
+	articles, _, _ = domain.ListArticles(nil, nil, nil, 0, 0, nil)
+	if !hasArticle(articles, slug) {
+		t.Fatalf("block hid the article from everybody")
+	}
+}
+
+func TestMutedArticlesDoNotTakePageSlots(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createArticle(t)
+	defer destroyArticle()
+	other, _ := domain.CreateUser(moderatorCreate, testClient)
+	defer destroyModerator()
+	defer DB.Get().Exec(fmt.Sprintf("DELETE FROM mutes WHERE muter_id IN (SELECT id FROM users WHERE email = '%s')", moderatorCreate.Email))
+	user, _ := domain.SignIn(userSignIn, testClient)
+	// more hidden articles than the page size
+	titles := []string{"muted one dsasdfsdf", "muted two dsasdfsdf"}
+	for _, title := range titles {
+		_, err := domain.CreateArticle(domain.ArticleCreate{Title: title, Description: "d", Body: "b"}, identify(user.Token))
+		if err != nil {
+			t.Fatalf("could not create article: %s", err)
+		}
+		defer DB.Get().Exec(fmt.Sprintf("DELETE FROM articles WHERE title = '%s'", title))
+	}
+
+	_, err := domain.MuteUser(userCreate.Username, identify(other.Token))
+	if err != nil {
+		t.Fatalf("could not mute user: %s", err)
+	}
+	seen := pageThroughArticles(t, identify(other.Token))
+	for _, title := range append(titles, articleCreate.Title) {
+		if seen[domain.SlugFromTitle(title)] {
+			t.Fatalf("article of muted author %s is listed for muter", title)
+		}
+	}
+}
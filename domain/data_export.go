@@ -0,0 +1,323 @@
+package domain
+
+import (
+	"../api_errors"
+	"../auth"
+	"../mail"
+	"../models"
+	"../storage"
+	"../utils"
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const dataExportTTL = time.Hour * 24
+
+// A new export can be requested this long after the previous one
+const dataExportInterval = time.Hour
+
+type DataExportResponse struct {
+	Status    string `json:"status"`
+	CreatedAt string `json:"createdAt"`
+	ExpiresAt string `json:"expiresAt"`
+	// only in the response to the request of the export, the link is also mailed when the archive is ready
+	DownloadURL string `json:"downloadUrl,omitempty"`
+}
+
+func dataExportToResponse(e *models.DataExport) DataExportResponse {
+	return DataExportResponse{
+		Status:    e.Status,
+		CreatedAt: formatTime(e.CreatedAt),
+		ExpiresAt: formatTime(e.ExpiresAt),
+	}
+}
+
+func dataExportURL(token string) string {
+	return fmt.Sprintf("%s/users/export/%s", utils.APIURL(), url.PathEscape(token))
+}
+
+// Archives are kept apart from avatars, the image route only serves those
+func dataExportKey(userID uint) string {
+	return fmt.Sprintf("exports/%d/%s.zip", userID, auth.RandomToken(24))
+}
+
+// Deletes expired archives at once and then every interval, so personal data does not outlive its link
+// when nobody asks for another export. Runs until the process exits
+func PurgeDataExports(interval time.Duration) {
+	for {
+		purgeDataExports()
+		time.Sleep(interval)
+	}
+}
+
+func purgeDataExports() {
+	keys, err := models.PurgeExpiredDataExports()
+	if err != nil {
+		log.Printf("could not purge expired data exports: %s", err)
+	}
+	deleteDataExportFiles(keys)
+}
+
+func deleteDataExportFiles(keys []string) {
+	for _, key := range keys {
+		err := storage.Delete(key)
+		if err != nil {
+			log.Printf("could not delete data export: %s", err)
+		}
+	}
+}
+
+// Starts building the archive in the background
+func RequestDataExport(actor *Actor) (*DataExportResponse, *api_errors.E) {
+	user, userErr := actor.user(ScopeSession)
+	if userErr != nil {
+		return nil, userErr
+	}
+	purgeDataExports()
+	latest, latestErr := models.GetLatestDataExport(user.ID)
+	if latestErr == nil && latest.Status != models.DataExportFailed {
+		next := latest.CreatedAt.Add(dataExportInterval)
+		if next.After(time.Now()) {
+			return nil, api_errors.NewError(http.StatusTooManyRequests).
+				Add("export", "was requested recently, the download link is sent by email").
+				SetHeader("Retry-After", retryAfter(next))
+		}
+	}
+
+	token := auth.RandomToken(32)
+	export := models.DataExport{
+		UserID:    user.ID,
+		TokenHash: auth.HashToken(token),
+		Status:    models.DataExportPending,
+		ExpiresAt: time.Now().Add(dataExportTTL),
+	}
+	err := models.CreateDataExport(&export)
+	if err != nil {
+		return nil, api_errors.NewError(http.StatusInternalServerError).Add("export", "could not start export")
+	}
+	go buildDataExport(export.ID, user.ID, token)
+
+	response := dataExportToResponse(&export)
+	response.DownloadURL = dataExportURL(token)
+	return &response, nil
+}
+
+// State of the latest export of actor
+func GetDataExport(actor *Actor) (*DataExportResponse, *api_errors.E) {
+	user, userErr := actor.user(ScopeSession)
+	if userErr != nil {
+		return nil, userErr
+	}
+	export, err := models.GetLatestDataExport(user.ID)
+	if err != nil || export.ExpiresAt.Before(time.Now()) {
+		return nil, api_errors.NewError(http.StatusNotFound).Add("export", "no export was requested")
+	}
+	response := dataExportToResponse(export)
+	return &response, nil
+}
+
+// Archive of a ready export. The token is all it takes, like a password reset link.
+// While the archive is built the export is returned without the archive
+func DownloadDataExport(token string) (*DataExportResponse, []byte, *api_errors.E) {
+	export, err := models.GetDataExportByToken(auth.HashToken(token))
+	if err != nil || export.Status == models.DataExportFailed {
+		return nil, nil, api_errors.NewError(http.StatusNotFound).Add("token", "export link is invalid or expired")
+	}
+	response := dataExportToResponse(export)
+	if export.Status != models.DataExportReady {
+		return &response, nil, nil
+	}
+	archive, archiveErr := storage.Get(export.ArchiveKey)
+	if archiveErr != nil {
+		log.Printf("could not read data export %d: %s", export.ID, archiveErr)
+		return nil, nil, api_errors.NewError(http.StatusNotFound).Add("token", "export link is invalid or expired")
+	}
+	return &response, archive, nil
+}
+
+func buildDataExport(exportID uint, userID uint, token string) {
+	data, err := models.GetUserData(userID)
+	var archive []byte
+	if err == nil {
+		archive, err = dataArchive(data)
+	}
+	key := dataExportKey(userID)
+	if err == nil {
+		err = storage.Put(key, archive)
+		if err == nil {
+			err = models.FinishDataExport(exportID, key)
+			if err != nil {
+				deleteDataExportFiles([]string{key})
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("could not build data export %d: %s", exportID, err)
+		_ = models.FailDataExport(exportID)
+		return
+	}
+
+	mailErr := mail.Send(mail.Message{
+		To:      data.User.Email,
+		Subject: "Your Conduit data export is ready",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nthe copy of your data you asked for is ready.\n"+
+				"Download it within %s from:\n%s\n\n"+
+				"If you did not ask for it, change your password, somebody else can use your account.",
+			data.User.Username, dataExportTTL, dataExportURL(token),
+		),
+	})
+	if mailErr != nil {
+		log.Printf("could not send data export mail: %s", mailErr)
+	}
+}
+
+type exportProfile struct {
+	Username      string  `json:"username"`
+	Email         string  `json:"email"`
+	EmailVerified bool    `json:"emailVerified"`
+	Bio           string  `json:"bio"`
+	Image         *string `json:"image"`
+	Role          string  `json:"role"`
+	Private       bool    `json:"private"`
+	TwoFactor     bool    `json:"twoFactorEnabled"`
+}
+
+type exportArticle struct {
+	Slug        string   `json:"slug"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Body        string   `json:"body"`
+	TagList     []string `json:"tagList"`
+	CreatedAt   string   `json:"createdAt"`
+	UpdatedAt   string   `json:"updatedAt"`
+}
+
+type exportComment struct {
+	Article   string `json:"article"`
+	Body      string `json:"body"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// Zip with profile.json, articles.json, comments.json, favorites.json, following.json, followers.json
+// and every article as Markdown in articles/
+func dataArchive(data *models.UserData) ([]byte, error) {
+	profile := exportProfile{
+		Username:      data.User.Username,
+		Email:         data.User.Email,
+		EmailVerified: data.User.EmailVerified,
+		Bio:           data.User.Bio,
+		Image:         data.User.Image,
+		Role:          data.User.Role,
+		Private:       data.User.Private,
+		TwoFactor:     data.User.TOTPEnabled,
+	}
+	articles := []exportArticle{}
+	for _, a := range data.Articles {
+		tags := data.Tags[a.ID]
+		if tags == nil {
+			tags = []string{}
+		}
+		articles = append(articles, exportArticle{
+			Slug:        a.Slug,
+			Title:       a.Title,
+			Description: a.Description,
+			Body:        a.Body,
+			TagList:     tags,
+			CreatedAt:   formatTime(a.CreatedAt),
+			UpdatedAt:   formatTime(a.UpdatedAt),
+		})
+	}
+	comments := []exportComment{}
+	for _, c := range data.Comments {
+		comments = append(comments, exportComment{Article: c.ArticleSlug, Body: c.Body, CreatedAt: formatTime(c.CreatedAt)})
+	}
+	favorites := []string{}
+	for _, a := range data.Favorites {
+		favorites = append(favorites, a.Slug)
+	}
+
+	files := []struct {
+		name  string
+		value interface{}
+	}{
+		{"profile.json", profile},
+		{"articles.json", articles},
+		{"comments.json", comments},
+		{"favorites.json", favorites},
+		{"following.json", usernames(data.Following)},
+		{"followers.json", usernames(data.Followers)},
+	}
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		content, err := json.MarshalIndent(file.value, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		err = writeArchiveFile(archive, file.name, content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, a := range articles {
+		err := writeArchiveFile(archive, articleArchiveName(a.Slug, data.Articles[i].ID), []byte(articleMarkdown(a)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := archive.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Name of the Markdown file of an article. Slugs are made from titles, anything that could
+// leave articles/ when unpacked falls back to the article id
+func articleArchiveName(slug string, id uint) string {
+	name := path.Base(slug)
+	if name != slug || name == "." || name == ".." || strings.ContainsAny(name, `/\:`) {
+		name = fmt.Sprintf("article-%d", id)
+	}
+	return "articles/" + name + ".md"
+}
+
+func writeArchiveFile(archive *zip.Writer, name string, content []byte) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	return err
+}
+
+func articleMarkdown(a exportArticle) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", a.Title)
+	if a.Description != "" {
+		fmt.Fprintf(&b, "_%s_\n\n", a.Description)
+	}
+	fmt.Fprintf(&b, "Published %s", a.CreatedAt)
+	if len(a.TagList) > 0 {
+		fmt.Fprintf(&b, ", tagged %s", strings.Join(a.TagList, ", "))
+	}
+	fmt.Fprintf(&b, "\n\n%s\n", a.Body)
+	return b.String()
+}
+
+func usernames(users []models.User) []string {
+	result := []string{}
+	for _, u := range users {
+		result = append(result, u.Username)
+	}
+	return result
+}
@@ -0,0 +1,118 @@
+package domain_test
+
+import (
+	"../DB"
+	"../domain"
+	"../storage"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Waits for the archive of the export behind downloadURL
+func downloadDataExport(t *testing.T, downloadURL string) []byte {
+	token := downloadURL[strings.LastIndex(downloadURL, "/")+1:]
+	for i := 0; i < 50; i++ {
+		time.Sleep(time.Millisecond * 100)
+		_, archive, err := domain.DownloadDataExport(token)
+		if err != nil {
+			t.Fatalf("could not download export: %s", err)
+		}
+		if archive != nil {
+			return archive
+		}
+	}
+	t.Fatalf("export was not ready in time")
+	return nil
+}
+
+func archiveFiles(t *testing.T, archive []byte) map[string]string {
+	reader, zipErr := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if zipErr != nil {
+		t.Fatalf("export is not a zip: %s", zipErr)
+	}
+	files := map[string]string{}
+	for _, f := range reader.File {
+		r, _ := f.Open()
+		content, _ := ioutil.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+func TestDataExportArchive(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createArticle(t)
+	defer destroyArticle()
+	storage.SetStorage(storage.NewLocalStorage(t.TempDir()))
+	user, _ := domain.SignIn(userSignIn, testClient)
+
+	export, err := domain.RequestDataExport(identify(user.Token))
+	if err != nil {
+		t.Fatalf("could not request export: %s", err)
+	}
+	_, err = domain.RequestDataExport(identify(user.Token))
+	if err == nil {
+		t.Fatalf("second export was started right after the first")
+	}
+
+	files := archiveFiles(t, downloadDataExport(t, export.DownloadURL))
+	if !strings.Contains(files["profile.json"], userCreate.Email) {
+		t.Fatalf("profile.json does not have the email: %s", files["profile.json"])
+	}
+	markdown := files["articles/"+domain.SlugFromTitle(articleCreate.Title)+".md"]
+	if !strings.Contains(markdown, articleCreate.Body) {
+		t.Fatalf("article markdown is missing the body: %s", markdown)
+	}
+
+	var row struct {
+		ArchiveKey string
+	}
+	DB.Get().Raw("SELECT archive_key FROM data_exports WHERE user_id = "+
+		"(SELECT id FROM users WHERE email = ?)", userCreate.Email).Scan(&row)
+	if !strings.HasPrefix(row.ArchiveKey, "exports/") {
+		t.Fatalf("archive is not in file storage: %q", row.ArchiveKey)
+	}
+	if _, getErr := storage.Get(row.ArchiveKey); getErr != nil {
+		t.Fatalf("could not read archive from storage: %s", getErr)
+	}
+
+	_, _, err = domain.DownloadDataExport("wrongtoken")
+	if err == nil {
+		t.Fatalf("export downloaded with wrong token")
+	}
+}
+
+func TestDataExportArticleNamesStayInArchive(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createArticle(t)
+	defer destroyArticle()
+	storage.SetStorage(storage.NewLocalStorage(t.TempDir()))
+	user, _ := domain.SignIn(userSignIn, testClient)
+	DB.Get().Exec(fmt.Sprintf("UPDATE articles SET slug = '../../escape' WHERE title = '%s'", articleCreate.Title))
+
+	export, err := domain.RequestDataExport(identify(user.Token))
+	if err != nil {
+		t.Fatalf("could not request export: %s", err)
+	}
+	files := archiveFiles(t, downloadDataExport(t, export.DownloadURL))
+	found := false
+	for name, content := range files {
+		if strings.Contains(name, "..") || strings.Count(name, "/") > 1 {
+			t.Fatalf("archive has an entry outside of it: %s", name)
+		}
+		if strings.HasPrefix(name, "articles/") && strings.Contains(content, articleCreate.Body) {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("article is missing from the archive")
+	}
+}
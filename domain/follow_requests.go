@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"../api_errors"
+	"../models"
+	"fmt"
+	"net/http"
+)
+
+// Users waiting for actor to approve their follow, oldest first
+func ListFollowRequests(actor *Actor) (*[]Profile, *api_errors.E) {
+	user, userErr := actor.user(ScopeRead)
+	if userErr != nil {
+		return nil, userErr
+	}
+	requesters, err := models.ListFollowRequests(user.ID)
+	if err != nil {
+		return nil, api_errors.NewError(http.StatusInternalServerError).Add("profiles", "could not get follow requests")
+	}
+	result := []Profile{}
+	for _, r := range *requesters {
+		result = append(result, Profile{
+			Username:  r.Username,
+			Bio:       r.Bio,
+			Image:     r.Image,
+			Following: models.IsFollowing(user.ID, r.ID),
+		})
+	}
+	return &result, nil
+}
+
+func followRequester(username string, actor *Actor) (*models.User, *models.User, *api_errors.E) {
+	user, userErr := actor.user(ScopeProfilesWrite)
+	if userErr != nil {
+		return nil, nil, userErr
+	}
+	requester, requesterErr := models.GetUserByUsername(username)
+	if requesterErr != nil {
+		return nil, nil, api_errors.NewError(http.StatusNotFound).Add("username", fmt.Sprintf("could not find user with this username: %s", username))
+	}
+	return user, requester, nil
+}
+
+// Lets username follow actor, returns the profile of username
+func ApproveFollowRequest(username string, actor *Actor) (*Profile, *api_errors.E) {
+	user, requester, err := followRequester(username, actor)
+	if err != nil {
+		return nil, err
+	}
+	approved, approveErr := models.ApproveFollowRequest(requester.ID, user.ID)
+	if approveErr != nil {
+		return nil, api_errors.NewError(http.StatusInternalServerError).Add("body", "could not approve follow request")
+	}
+	if !approved {
+		return nil, api_errors.NewError(http.StatusNotFound).Add("username", "there is no follow request from this user")
+	}
+	auditActor(AuditFollow, actor, requester, "approved by "+user.Username)
+	return &Profile{
+		Username:  requester.Username,
+		Bio:       requester.Bio,
+		Image:     requester.Image,
+		Following: models.IsFollowing(user.ID, requester.ID),
+	}, nil
+}
+
+// Drops the request of username without telling them
+func RejectFollowRequest(username string, actor *Actor) *api_errors.E {
+	user, requester, err := followRequester(username, actor)
+	if err != nil {
+		return err
+	}
+	rejected, rejectErr := models.DeleteFollowRequest(requester.ID, user.ID)
+	if rejectErr != nil {
+		return api_errors.NewError(http.StatusInternalServerError).Add("body", "could not reject follow request")
+	}
+	if !rejected {
+		return api_errors.NewError(http.StatusNotFound).Add("username", "there is no follow request from this user")
+	}
+	return nil
+}
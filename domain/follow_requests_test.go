@@ -0,0 +1,122 @@
+package domain_test
+
+import (
+	"../DB"
+	"../domain"
+	"fmt"
+	"testing"
+)
+
+func TestPrivateAccountFollowRequests(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createArticle(t)
+	defer destroyArticle()
+	other, _ := domain.CreateUser(moderatorCreate, testClient)
+	defer destroyModerator()
+	defer DB.Get().Exec(fmt.Sprintf("DELETE FROM follow_requests WHERE requester_id IN (SELECT id FROM users WHERE email = '%s')", moderatorCreate.Email))
+	user, _ := domain.SignIn(userSignIn, testClient)
+	slug := domain.SlugFromTitle(articleCreate.Title)
+
+	private := true
+	updated, updateErr := domain.UpdateUser(domain.UserUpdate{Private: &private}, identify(user.Token))
+	if updateErr != nil || !updated.Private {
+		t.Fatalf("could not make account private: %v", updateErr)
+	}
+	_, err := domain.GetArticle(slug, identify(other.Token))
+	if err == nil {
+		t.Fatalf("article of private account is shown to a stranger")
+	}
+	_, err = domain.GetArticle(slug, nil)
+	if err == nil {
+		t.Fatalf("article of private account is shown to anonymous viewer")
+	}
+	articles, _, _ := domain.ListArticles(nil, nil, nil, 0, 0, identify(other.Token))
+	for _, a := range *articles {
+		if a.Slug == slug {
+			t.Fatalf("article of private account is listed for a stranger")
+		}
+	}
+
+	profile, followErr := domain.FollowUser(userCreate.Username, identify(other.Token))
+	if followErr != nil {
+		t.Fatalf("could not request to follow: %s", followErr)
+	}
+	if profile.Following || !profile.Requested {
+		t.Fatalf("follow of private account is not a request: %+v", *profile)
+	}
+	requests, _ := domain.ListFollowRequests(identify(user.Token))
+	if len(*requests) != 1 || (*requests)[0].Username != moderatorCreate.Username {
+		t.Fatalf("unexpected follow requests: %v", *requests)
+	}
+
+	_, err = domain.ApproveFollowRequest(moderatorCreate.Username, identify(user.Token))
+	if err != nil {
+		t.Fatalf("could not approve follow request: %s", err)
+	}
+	_, err = domain.GetArticle(slug, identify(other.Token))
+	if err != nil {
+		t.Fatalf("approved follower can not see article: %s", err)
+	}
+	err = domain.RejectFollowRequest(moderatorCreate.Username, identify(user.Token))
+	if err == nil {
+		t.Fatalf("rejected a request that was already approved")
+	}
+}
+
+// Checks that every page of size 1 holds an article, hidden ones must not take up slots.
+// Returns the slugs seen on all pages
+func pageThroughArticles(t *testing.T, actor *domain.Actor) map[string]bool {
+	_, count, err := domain.ListArticles(nil, nil, nil, 1, 0, actor)
+	if err != nil {
+		t.Fatalf("could not list articles: %s", err)
+	}
+	seen := map[string]bool{}
+	for offset := uint(0); offset < count; offset++ {
+		page, _, pageErr := domain.ListArticles(nil, nil, nil, 1, offset, actor)
+		if pageErr != nil {
+			t.Fatalf("could not list articles: %s", pageErr)
+		}
+		if len(*page) != 1 {
+			t.Fatalf("page at offset %d of %d has %d articles", offset, count, len(*page))
+		}
+		seen[(*page)[0].Slug] = true
+	}
+	return seen
+}
+
+func TestPrivateArticlesDoNotTakePageSlots(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createArticle(t)
+	defer destroyArticle()
+	other, _ := domain.CreateUser(moderatorCreate, testClient)
+	defer destroyModerator()
+	user, _ := domain.SignIn(userSignIn, testClient)
+	titles := []string{"private one dsasdfsdf", "private two dsasdfsdf"}
+	for _, title := range titles {
+		_, err := domain.CreateArticle(domain.ArticleCreate{Title: title, Description: "d", Body: "b"}, identify(user.Token))
+		if err != nil {
+			t.Fatalf("could not create article: %s", err)
+		}
+		defer DB.Get().Exec(fmt.Sprintf("DELETE FROM articles WHERE title = '%s'", title))
+	}
+	public := domain.ArticleCreate{Title: "public dsasdfsdf", Description: "d", Body: "b"}
+	_, err := domain.CreateArticle(public, identify(other.Token))
+	if err != nil {
+		t.Fatalf("could not create article: %s", err)
+	}
+	defer DB.Get().Exec(fmt.Sprintf("DELETE FROM articles WHERE title = '%s'", public.Title))
+
+	private := true
+	domain.UpdateUser(domain.UserUpdate{Private: &private}, identify(user.Token))
+	seen := pageThroughArticles(t, nil)
+	if !seen[domain.SlugFromTitle(public.Title)] {
+		t.Fatalf("public article is missing from the pages")
+	}
+	for _, title := range append(titles, articleCreate.Title) {
+		if seen[domain.SlugFromTitle(title)] {
+			t.Fatalf("private article %s is listed for anonymous viewer", title)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package domain
+
+import (
+	"../api_errors"
+	"../auth"
+	"../mail"
+	"../models"
+	"../utils"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Failed sign ins are counted per account and per client address.
+// After the free attempts each failure locks for twice as long as the previous one, up to the max
+const (
+	loginFailureWindow  = time.Hour * 24
+	accountFreeAttempts = 5
+	accountMaxLock      = time.Hour
+	clientFreeAttempts  = 20
+	clientMaxLock       = time.Minute * 15
+	unlockTokenTTL      = time.Hour
+)
+
+type AccountUnlock struct {
+	Token string `json:"token"`
+}
+
+func accountThrottleKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func clientThrottleKey(client Client) string {
+	return "ip:" + client.IP
+}
+
+func lockDuration(failures uint, free uint, max time.Duration) time.Duration {
+	if failures < free {
+		return 0
+	}
+	lock := time.Minute
+	for i := free; i < failures && lock < max; i++ {
+		lock *= 2
+	}
+	if lock > max {
+		return max
+	}
+	return lock
+}
+
+func retryAfter(until time.Time) string {
+	seconds := int(time.Until(until).Seconds()) + 1
+	return strconv.Itoa(seconds)
+}
+
+// Checked before the password, so a locked account does not tell whether a guess was right
+func checkLoginThrottle(email string, client Client) *api_errors.E {
+	now := time.Now()
+	if client.IP != "" {
+		throttle, err := models.GetLoginThrottle(clientThrottleKey(client))
+		if err != nil {
+			log.Printf("could not check sign in throttle: %s", err)
+		} else if throttle.LockedUntil != nil && throttle.LockedUntil.After(now) {
+			return api_errors.NewError(http.StatusTooManyRequests).
+				Add("body", "too many failed sign in attempts, try again later").
+				SetHeader("Retry-After", retryAfter(*throttle.LockedUntil))
+		}
+	}
+	throttle, err := models.GetLoginThrottle(accountThrottleKey(email))
+	if err != nil {
+		log.Printf("could not check sign in throttle: %s", err)
+	} else if throttle.LockedUntil != nil && throttle.LockedUntil.After(now) {
+		return api_errors.NewError(http.StatusLocked).
+			Add("email", "account is locked after too many failed sign in attempts, try again later or use the link sent by email").
+			SetHeader("Retry-After", retryAfter(*throttle.LockedUntil))
+	}
+	return nil
+}
+
+func countFailure(key string, free uint, max time.Duration) uint {
+	failures, err := models.RecordLoginFailure(key, loginFailureWindow)
+	if err != nil {
+		log.Printf("could not record failed sign in: %s", err)
+		return 0
+	}
+	lock := lockDuration(failures, free, max)
+	if lock > 0 {
+		lockErr := models.LockLogin(key, time.Now().Add(lock))
+		if lockErr != nil {
+			log.Printf("could not lock sign in: %s", lockErr)
+		}
+	}
+	return failures
+}
+
+// User is nil when nobody has the email, the attempt is still counted so both cases look the same
+func recordLoginFailure(email string, user *models.User, client Client) {
+	if client.IP != "" {
+		countFailure(clientThrottleKey(client), clientFreeAttempts, clientMaxLock)
+	}
+	failures := countFailure(accountThrottleKey(email), accountFreeAttempts, accountMaxLock)
+	if failures == accountFreeAttempts && user != nil {
+		err := sendUnlockEmail(user)
+		if err != nil {
+			log.Printf("could not send unlock mail: %s", err)
+		}
+	}
+}
+
+func clearLoginFailures(email string) {
+	err := models.ClearLoginThrottle(accountThrottleKey(email))
+	if err != nil {
+		log.Printf("could not clear failed sign ins: %s", err)
+	}
+}
+
+func sendUnlockEmail(user *models.User) error {
+	token := auth.GetPurposeTokenString(auth.PurposeUnlockAccount, strconv.Itoa(int(user.ID)), user.Email, unlockTokenTTL)
+	link := fmt.Sprintf("%s/unlock?token=%s", utils.AppURL(), url.QueryEscape(token))
+	return mail.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Your Conduit account was locked",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nthere were several failed attempts to sign in to your account, so it is locked for a while.\n"+
+				"If it was you, follow this link within %s to unlock it now:\n%s\n\n"+
+				"If it was not you, consider changing your password.",
+			user.Username, unlockTokenTTL, link,
+		),
+	})
+}
+
+// Clears the lockout of the account and the throttle of the client that follows the link.
+// Every link works once, or whoever has it could clear the lockout again after each round of guesses
+func UnlockAccount(u AccountUnlock, client Client) *api_errors.E {
+	invalid := api_errors.NewError(http.StatusUnauthorized).Add("token", "unlock token is invalid or expired")
+	claims, err := auth.GetPurposeClaims(u.Token, auth.PurposeUnlockAccount)
+	if err != nil || claims.Id == "" {
+		return invalid
+	}
+	first, useErr := models.UseTokenOnce(claims.Id, time.Unix(claims.ExpiresAt, 0))
+	if useErr != nil {
+		return api_errors.NewError(http.StatusInternalServerError).Add("token", "could not unlock account")
+	}
+	if !first {
+		return invalid
+	}
+	clearLoginFailures(claims.Email)
+	if client.IP != "" {
+		clientErr := models.ClearLoginThrottle(clientThrottleKey(client))
+		if clientErr != nil {
+			log.Printf("could not clear failed sign ins: %s", clientErr)
+		}
+	}
+	audit(models.AuditEvent{Type: AuditAccountUnlock, Email: claims.Email, Outcome: OutcomeSuccess})
+	return nil
+}
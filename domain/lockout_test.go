@@ -0,0 +1,52 @@
+package domain_test
+
+import (
+	"../DB"
+	"../domain"
+	"../mail"
+	"testing"
+)
+
+func TestAccountLockout(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createUser(t)
+	defer destroyUser()
+	mailer := &recordingMailer{}
+	mail.SetMailer(mailer)
+	defer mail.SetMailer(mail.NewLocalMailer(""))
+	client := domain.Client{IP: "192.0.2.10"}
+	defer DB.Get().Exec("DELETE FROM login_throttles WHERE key = 'ip:192.0.2.10'")
+
+	wrong := domain.UserSignIn{Email: userCreate.Email, Password: "wrong password"}
+	for i := 0; i < 5; i++ {
+		_, err := domain.SignIn(wrong, client)
+		if err == nil {
+			t.Fatalf("signed in with wrong password")
+		}
+	}
+	_, lockedErr := domain.SignIn(userSignIn, client)
+	if lockedErr == nil {
+		t.Fatalf("signed in to locked account")
+	}
+	if len(mailer.sent) != 1 || mailer.sent[0].To != userCreate.Email {
+		t.Fatalf("unlock mail was not sent")
+	}
+	match := linkTokenRe.FindStringSubmatch(mailer.sent[0].Body)
+	if match == nil {
+		t.Fatalf("unlock mail has no token: %s", mailer.sent[0].Body)
+	}
+
+	unlockErr := domain.UnlockAccount(domain.AccountUnlock{Token: match[1]}, client)
+	if unlockErr != nil {
+		t.Fatalf("could not unlock account: %s", unlockErr)
+	}
+	replayErr := domain.UnlockAccount(domain.AccountUnlock{Token: match[1]}, client)
+	if replayErr == nil {
+		t.Fatalf("unlock link was accepted twice")
+	}
+	_, signInErr := domain.SignIn(userSignIn, client)
+	if signInErr != nil {
+		t.Fatalf("could not sign in after unlock: %s", signInErr)
+	}
+}
@@ -0,0 +1,156 @@
+package domain
+
+import (
+	"../api_errors"
+	"../models"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Actors shown with every notification, the rest are only counted
+const notificationActorsShown = 3
+
+type NotificationArticle struct {
+	Slug  string `json:"slug"`
+	Title string `json:"title"`
+}
+
+type NotificationResponse struct {
+	ID   uint   `json:"id"`
+	Type string `json:"type"`
+	// like "5 people favorited your article"
+	Message string `json:"message"`
+	// latest actors first
+	Actors      []Profile `json:"actors"`
+	ActorsCount uint      `json:"actorsCount"`
+	// nil for follows, and when the article was deleted
+	Article   *NotificationArticle `json:"article"`
+	Read      bool                 `json:"read"`
+	CreatedAt string               `json:"createdAt"`
+	UpdatedAt string               `json:"updatedAt"`
+}
+
+type NotificationQuery struct {
+	Unread bool
+	Limit  uint
+	Offset uint
+}
+
+// Tells userID that actorID acted on them or their article. Actions on oneself and actions of users
+// userID muted or blocked are not reported. Failures are only logged, the action itself succeeded
+func notify(userID uint, notificationType string, articleID *uint, actorID uint) {
+	if userID == actorID || models.IsMuted(userID, actorID) || models.IsBlocked(userID, actorID) {
+		return
+	}
+	err := models.Notify(userID, notificationType, articleID, actorID)
+	if err != nil {
+		log.Printf("could not write %s notification: %s", notificationType, err)
+	}
+}
+
+func notificationMessage(n models.NotificationList, actors []Profile) string {
+	who := fmt.Sprintf("%d people", n.ActorsCount)
+	if n.ActorsCount == 1 && len(actors) == 1 {
+		who = actors[0].Username
+	}
+	article := "your article"
+	if n.ArticleTitle != nil {
+		article = fmt.Sprintf("your article \"%s\"", *n.ArticleTitle)
+	}
+	switch n.Type {
+	case models.NotificationFollow:
+		return who + " followed you"
+	case models.NotificationFollowRequest:
+		return who + " asked to follow you"
+	case models.NotificationFavorite:
+		return who + " favorited " + article
+	case models.NotificationComment:
+		return who + " commented on " + article
+	}
+	return who + " " + n.Type
+}
+
+// Notifications of actor, latest activity first, with the total and the unread counts
+func ListNotifications(q NotificationQuery, actor *Actor) (*[]NotificationResponse, uint, uint, *api_errors.E) {
+	user, userErr := actor.user(ScopeRead)
+	if userErr != nil {
+		return nil, 0, 0, userErr
+	}
+	if q.Limit == 0 {
+		q.Limit = 20
+	}
+	rows, count, unread, err := models.ListNotifications(user.ID, q.Unread, q.Limit, q.Offset)
+	if err != nil {
+		return nil, 0, 0, api_errors.NewError(http.StatusInternalServerError).Add("notifications", "could not get notifications")
+	}
+
+	ids := []uint{}
+	for _, n := range *rows {
+		ids = append(ids, n.ID)
+	}
+	actorRows, actorsErr := models.ListNotificationActors(user.ID, ids, notificationActorsShown)
+	if actorsErr != nil {
+		return nil, 0, 0, api_errors.NewError(http.StatusInternalServerError).Add("notifications", "could not get notifications")
+	}
+	actors := map[uint][]Profile{}
+	for _, a := range *actorRows {
+		actors[a.NotificationID] = append(actors[a.NotificationID], Profile{
+			Username:  a.Username,
+			Bio:       a.Bio,
+			Image:     a.Image,
+			Following: a.Following,
+		})
+	}
+
+	result := []NotificationResponse{}
+	for _, n := range *rows {
+		shown := actors[n.ID]
+		if shown == nil {
+			shown = []Profile{}
+		}
+		response := NotificationResponse{
+			ID:          n.ID,
+			Type:        n.Type,
+			Message:     notificationMessage(n, shown),
+			Actors:      shown,
+			ActorsCount: n.ActorsCount,
+			Read:        n.ReadAt != nil,
+			CreatedAt:   formatTime(n.CreatedAt),
+			UpdatedAt:   formatTime(n.UpdatedAt),
+		}
+		if n.ArticleSlug != nil && n.ArticleTitle != nil {
+			response.Article = &NotificationArticle{Slug: *n.ArticleSlug, Title: *n.ArticleTitle}
+		}
+		result = append(result, response)
+	}
+	return &result, count, unread, nil
+}
+
+// Later events of the same kind start a new notification instead of joining the read one
+func MarkNotificationRead(id uint, actor *Actor) *api_errors.E {
+	user, userErr := actor.user(ScopeSession)
+	if userErr != nil {
+		return userErr
+	}
+	found, err := models.MarkNotificationRead(user.ID, id)
+	if err != nil {
+		return api_errors.NewError(http.StatusInternalServerError).Add("notification", "could not mark notification as read")
+	}
+	if !found {
+		return api_errors.NewError(http.StatusNotFound).Add("notification", "not found")
+	}
+	return nil
+}
+
+func MarkAllNotificationsRead(actor *Actor) *api_errors.E {
+	user, userErr := actor.user(ScopeSession)
+	if userErr != nil {
+		return userErr
+	}
+	err := models.MarkAllNotificationsRead(user.ID)
+	if err != nil {
+		return api_errors.NewError(http.StatusInternalServerError).Add("notifications", "could not mark notifications as read")
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package domain_test
+
+import (
+	"../domain"
+	"testing"
+)
+
+func TestNotificationsAreAggregated(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createArticle(t)
+	defer destroyArticle()
+	other, _ := domain.CreateUser(moderatorCreate, testClient)
+	defer destroyModerator()
+	user, _ := domain.SignIn(userSignIn, testClient)
+	slug := domain.SlugFromTitle(articleCreate.Title)
+
+	_, err := domain.FavoriteArticle(slug, identify(user.Token))
+	if err != nil {
+		t.Fatalf("could not favorite article: %s", err)
+	}
+	_, _, unread, err := domain.ListNotifications(domain.NotificationQuery{}, identify(user.Token))
+	if err != nil || unread != 0 {
+		t.Fatalf("author is notified of own favorite: %v", err)
+	}
+
+	_, err = domain.FavoriteArticle(slug, identify(other.Token))
+	if err != nil {
+		t.Fatalf("could not favorite article: %s", err)
+	}
+	_, err = domain.UnfavoriteArticle(slug, identify(other.Token))
+	if err != nil {
+		t.Fatalf("could not unfavorite article: %s", err)
+	}
+	_, err = domain.FavoriteArticle(slug, identify(other.Token))
+	if err != nil {
+		t.Fatalf("could not favorite article again: %s", err)
+	}
+	_, err = domain.FollowUser(userCreate.Username, identify(other.Token))
+	if err != nil {
+		t.Fatalf("could not follow: %s", err)
+	}
+
+	notifications, count, unread, err := domain.ListNotifications(domain.NotificationQuery{}, identify(user.Token))
+	if err != nil {
+		t.Fatalf("could not list notifications: %s", err)
+	}
+	if count != 2 || unread != 2 {
+		t.Fatalf("expected a follow and a favorite notification, got %d (%d unread)", count, unread)
+	}
+	for _, n := range *notifications {
+		if n.ActorsCount != 1 || len(n.Actors) != 1 || n.Actors[0].Username != moderatorCreate.Username {
+			t.Fatalf("repeated favorite is counted twice: %+v", n)
+		}
+		if n.Type == "favorite" && (n.Article == nil || n.Article.Slug != slug) {
+			t.Fatalf("favorite notification has no article: %+v", n)
+		}
+	}
+
+	err = domain.MarkNotificationRead((*notifications)[0].ID, identify(other.Token))
+	if err == nil {
+		t.Fatalf("marked a notification of another user as read")
+	}
+	err = domain.MarkNotificationRead((*notifications)[0].ID, identify(user.Token))
+	if err != nil {
+		t.Fatalf("could not mark notification as read: %s", err)
+	}
+	_, count, unread, _ = domain.ListNotifications(domain.NotificationQuery{Unread: true}, identify(user.Token))
+	if count != 1 || unread != 1 {
+		t.Fatalf("expected one unread notification, got %d", unread)
+	}
+	err = domain.MarkAllNotificationsRead(identify(user.Token))
+	if err != nil {
+		t.Fatalf("could not mark notifications as read: %s", err)
+	}
+	_, _, unread, _ = domain.ListNotifications(domain.NotificationQuery{}, identify(user.Token))
+	if unread != 0 {
+		t.Fatalf("notifications are unread after marking all as read")
+	}
+}
@@ -0,0 +1,189 @@
+package domain
+
+import (
+	"../api_errors"
+	"../auth"
+	"../models"
+	"../oidc"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const oidcLoginTTL = time.Minute * 10
+
+type OIDCAuthorization struct {
+	AuthorizationURL string `json:"authorizationUrl"`
+	// kept by the client that started sign in and sent back with the callback,
+	// so code and state of a sign in started by somebody else are refused
+	Binding string `json:"binding"`
+}
+
+type OIDCCallback struct {
+	Code    string `json:"code"`
+	State   string `json:"state"`
+	Binding string `json:"binding"`
+}
+
+func ListOIDCProviders() []string {
+	return oidc.ProviderNames()
+}
+
+// Starts sign in at the provider, the client should send the user to the returned url
+func StartOIDC(providerName string) (*OIDCAuthorization, *api_errors.E) {
+	provider, found := oidc.GetProvider(providerName)
+	if !found {
+		return nil, api_errors.NewError(http.StatusNotFound).Add("provider", fmt.Sprintf("unknown provider %s", providerName))
+	}
+	state := oidc.NewState()
+	binding := auth.RandomToken(32)
+	login := models.OIDCLogin{
+		StateHash:    auth.HashToken(state),
+		BindingHash:  auth.HashToken(binding),
+		Provider:     provider.Name,
+		Nonce:        oidc.NewNonce(),
+		CodeVerifier: oidc.NewCodeVerifier(),
+		ExpiresAt:    time.Now().Add(oidcLoginTTL),
+	}
+	authURL, err := provider.AuthCodeURL(state, login.Nonce, login.CodeVerifier)
+	if err != nil {
+		log.Println(err)
+		return nil, api_errors.NewError(http.StatusBadGateway).Add("provider", "provider is not available")
+	}
+	saveErr := models.CreateOIDCLogin(&login)
+	if saveErr != nil {
+		return nil, api_errors.NewError(http.StatusInternalServerError).Add("provider", "could not start sign in")
+	}
+	return &OIDCAuthorization{AuthorizationURL: authURL, Binding: binding}, nil
+}
+
+// Finishes sign in with code and state the provider redirected back with.
+// Known identities sign in to their user, new identities with verified email are linked to the user with this email,
+// otherwise a new user is registered
+func FinishOIDC(providerName string, c OIDCCallback, client Client) (UserResponse, *api_errors.E) {
+	invalid := api_errors.NewError(http.StatusUnauthorized).Add("state", "sign in attempt is invalid or expired")
+	provider, found := oidc.GetProvider(providerName)
+	if !found {
+		return UserResponse{}, api_errors.NewError(http.StatusNotFound).Add("provider", fmt.Sprintf("unknown provider %s", providerName))
+	}
+	login, loginErr := models.TakeOIDCLogin(auth.HashToken(c.State))
+	if loginErr != nil || login.Provider != provider.Name {
+		return UserResponse{}, invalid
+	}
+	if subtle.ConstantTimeCompare([]byte(login.BindingHash), []byte(auth.HashToken(c.Binding))) != 1 {
+		return UserResponse{}, invalid
+	}
+	claims, err := provider.Exchange(c.Code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Println(err)
+		return UserResponse{}, api_errors.NewError(http.StatusUnauthorized).Add("code", "could not sign in with provider")
+	}
+
+	user, userErr := userForIdentity(provider.Name, claims)
+	if userErr != nil {
+		return UserResponse{}, userErr
+	}
+	if user.TOTPEnabled {
+		return twoFactorChallenge(user), nil
+	}
+	tokenString, refreshToken, tokenErr := issueTokens(user, client)
+	if tokenErr != nil {
+		return UserResponse{}, tokenErr
+	}
+	auditClient(AuditSignIn, client, user, user.Email, OutcomeSuccess, "oidc:"+provider.Name)
+	return userToResponse(user, tokenString, refreshToken), nil
+}
+
+func userForIdentity(provider string, claims *oidc.IDClaims) (*models.User, *api_errors.E) {
+	user, err := models.GetUserByIdentity(provider, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if claims.Email == "" {
+		return nil, api_errors.NewError(http.StatusUnprocessableEntity).Add("email", "provider did not share email")
+	}
+	reservedErr := api_errors.NewValidationError()
+	validateEmail(claims.Email, reservedErr)
+	if reservedErr.HasErrors() {
+		return nil, reservedErr
+	}
+
+	existing, existingErr := models.GetUser(claims.Email)
+	if existingErr == nil {
+		// unverified provider email could belong to anyone, linking it would hand over the account
+		if !claims.EmailVerified {
+			return nil, api_errors.NewError(http.StatusConflict).Add("email", "is already registered, sign in with password first")
+		}
+		linkErr := models.LinkIdentity(existing.ID, provider, claims.Subject, claims.Email)
+		if linkErr != nil {
+			return nil, api_errors.NewError(http.StatusInternalServerError).Add("provider", "could not link account")
+		}
+		if !existing.EmailVerified {
+			_, _ = models.SetEmailVerified(existing.ID, claims.Email)
+			existing.EmailVerified = true
+		}
+		return existing, nil
+	}
+
+	// nobody knows this password, user can set one with password reset
+	passwordHash, hashErr := hashPassword(auth.RandomToken(32))
+	if hashErr != nil {
+		return nil, hashErr
+	}
+	created := models.User{
+		Username:      uniqueUsername(usernameFromClaims(claims)),
+		Email:         claims.Email,
+		PasswordHash:  passwordHash,
+		EmailVerified: claims.EmailVerified,
+		Role:          models.RoleUser,
+	}
+	saveErr := created.Save()
+	if saveErr != nil {
+		return nil, api_errors.NewError(http.StatusInternalServerError).Add("user", "could not create user")
+	}
+	linkErr := models.LinkIdentity(created.ID, provider, claims.Subject, claims.Email)
+	if linkErr != nil {
+		return nil, api_errors.NewError(http.StatusInternalServerError).Add("provider", "could not link account")
+	}
+	if !created.EmailVerified {
+		mailErr := sendVerificationEmail(&created)
+		if mailErr != nil {
+			log.Printf("could not send verification mail: %s", mailErr)
+		}
+	}
+	return &created, nil
+}
+
+var notUsernameChars = regexp.MustCompile(`[^a-zA-Z0-9_\-]+`)
+
+func usernameFromClaims(claims *oidc.IDClaims) string {
+	for _, candidate := range []string{claims.PreferredUsername, claims.Name, strings.Split(claims.Email, "@")[0]} {
+		name := strings.Trim(notUsernameChars.ReplaceAllString(candidate, "-"), "-")
+		if name != "" {
+			return name
+		}
+	}
+	return "user"
+}
+
+// First of name, name-2, name-3... that a user could register, reserved and taken names are skipped
+func uniqueUsername(name string) string {
+	if len(name) > usernameMaxLength-4 {
+		name = name[:usernameMaxLength-4]
+	}
+	result := name
+	for i := 2; i < 1000; i++ {
+		validationErr := api_errors.NewValidationError()
+		validateUsername(result, 0, validationErr)
+		if !validationErr.HasErrors() {
+			return result
+		}
+		result = fmt.Sprintf("%s-%d", name, i)
+	}
+	// saving fails with a clear error if even this is taken
+	return result
+}
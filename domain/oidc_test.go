@@ -0,0 +1,126 @@
+package domain_test
+
+import (
+	"../DB"
+	"../domain"
+	"../models"
+	"../oidc"
+	"../oidc/oidctest"
+	"testing"
+)
+
+func setupOIDC(t *testing.T) *oidctest.Server {
+	server := oidctest.NewServer("conduit", "secret")
+	err := oidc.SetProviders([]*oidc.Provider{{
+		Name:         "test",
+		Issuer:       server.Issuer(),
+		ClientID:     "conduit",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:4000/oidc/callback",
+	}})
+	if err != nil {
+		t.Fatalf("could not set oidc providers: %s", err)
+	}
+	return server
+}
+
+func signInOIDC(t *testing.T, server *oidctest.Server, user oidctest.User) (domain.UserResponse, domain.OIDCCallback) {
+	server.SignInAs(user)
+	authorization, err := domain.StartOIDC("test")
+	if err != nil {
+		t.Fatalf("could not start oidc sign in: %s", err)
+	}
+	code, state, authErr := server.Authorize(authorization.AuthorizationURL)
+	if authErr != nil {
+		t.Fatalf("could not authorize at provider: %s", authErr)
+	}
+	callback := domain.OIDCCallback{Code: code, State: state, Binding: authorization.Binding}
+	result, finishErr := domain.FinishOIDC("test", callback, testClient)
+	if finishErr != nil {
+		t.Fatalf("could not finish oidc sign in: %s", finishErr)
+	}
+	return result, callback
+}
+
+func TestOIDCLinksVerifiedEmail(t *testing.T) {
+	initDb()
+	defer closeDb()
+	server := setupOIDC(t)
+	defer server.Close()
+	createUser(t)
+	defer destroyUser()
+	defer DB.Get().Where(&models.UserIdentity{Provider: "test"}).Delete(&models.UserIdentity{})
+
+	result, callback := signInOIDC(t, server, oidctest.User{Subject: "linked", Email: userCreate.Email, EmailVerified: true})
+	if result.Username != userCreate.Username || result.Token == "" {
+		t.Fatalf("oidc sign in did not sign in existing user: %+v", result)
+	}
+	if !result.EmailVerified {
+		t.Fatalf("email verified by provider is not verified")
+	}
+
+	_, replayErr := domain.FinishOIDC("test", callback, testClient)
+	if replayErr == nil {
+		t.Fatalf("oidc state was accepted twice")
+	}
+}
+
+func TestOIDCDoesNotLinkUnverifiedEmail(t *testing.T) {
+	initDb()
+	defer closeDb()
+	server := setupOIDC(t)
+	defer server.Close()
+	createUser(t)
+	defer destroyUser()
+
+	server.SignInAs(oidctest.User{Subject: "attacker", Email: userCreate.Email})
+	authorization, _ := domain.StartOIDC("test")
+	code, state, _ := server.Authorize(authorization.AuthorizationURL)
+	_, err := domain.FinishOIDC("test", domain.OIDCCallback{Code: code, State: state, Binding: authorization.Binding}, testClient)
+	if err == nil {
+		t.Fatalf("unverified provider email was linked to existing user")
+	}
+}
+
+func TestOIDCRegistersNewUser(t *testing.T) {
+	initDb()
+	defer closeDb()
+	server := setupOIDC(t)
+	defer server.Close()
+	email := "oidc-new@u"
+	defer DB.Get().Where(&models.UserIdentity{Provider: "test"}).Delete(&models.UserIdentity{})
+	defer DB.Get().Where(&models.User{Email: email}).Delete(&models.User{})
+
+	result, _ := signInOIDC(t, server, oidctest.User{Subject: "new", Email: email, EmailVerified: true, Name: "Oidc User"})
+	if result.Email != email || result.Username != "Oidc-User" {
+		t.Fatalf("new user has wrong data: %+v", result)
+	}
+	again, _ := signInOIDC(t, server, oidctest.User{Subject: "new", Email: "changed@u", EmailVerified: true})
+	if again.Email != email {
+		t.Fatalf("second sign in did not find user by identity")
+	}
+}
+
+func TestOIDCCallbackNeedsBindingOfStartingClient(t *testing.T) {
+	initDb()
+	defer closeDb()
+	server := setupOIDC(t)
+	defer server.Close()
+
+	// attacker gets code and state for their own account, victim started another sign in
+	server.SignInAs(oidctest.User{Subject: "attacker", Email: "attacker@u", EmailVerified: true})
+	attacker, _ := domain.StartOIDC("test")
+	code, state, _ := server.Authorize(attacker.AuthorizationURL)
+	victim, _ := domain.StartOIDC("test")
+	_, err := domain.FinishOIDC("test", domain.OIDCCallback{Code: code, State: state, Binding: victim.Binding}, testClient)
+	if err == nil {
+		t.Fatalf("oidc sign in was finished by a client that did not start it")
+	}
+
+	attacker, _ = domain.StartOIDC("test")
+	code, state, _ = server.Authorize(attacker.AuthorizationURL)
+	_, err = domain.FinishOIDC("test", domain.OIDCCallback{Code: code, State: state}, testClient)
+	if err == nil {
+		t.Fatalf("oidc sign in was finished without binding")
+	}
+}
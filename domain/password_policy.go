@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"../api_errors"
+	"../auth"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// compared case insensitive
+	Banned []string
+	// directory with breached password range files, check is off when empty
+	BreachedDir string
+}
+
+var DefaultBannedPasswords = []string{
+	"password", "password1", "12345678", "123456789", "1234567890", "qwertyui", "qwertyuiop", "11111111", "iloveyou", "conduit",
+}
+
+var passwordPolicy = PasswordPolicy{
+	MinLength: 8,
+	MaxLength: 128,
+	Banned:    DefaultBannedPasswords,
+}
+
+var bannedPasswords = bannedSet(DefaultBannedPasswords)
+
+func bannedSet(list []string) map[string]bool {
+	result := map[string]bool{}
+	for _, p := range list {
+		result[strings.ToLower(p)] = true
+	}
+	return result
+}
+
+func SetPasswordPolicy(p PasswordPolicy) {
+	passwordPolicy = p
+	bannedPasswords = bannedSet(p.Banned)
+}
+
+// Adds password errors to err, email and username of the user can not be used as password
+func validatePassword(password string, email string, username string, err *api_errors.E) {
+	length := utf8.RuneCountInString(password)
+	if length == 0 {
+		err.Add("password", "can't be blank")
+		return
+	}
+	if length < passwordPolicy.MinLength {
+		err.Add("password", fmt.Sprintf("is too short (minimum is %d characters)", passwordPolicy.MinLength))
+		return
+	}
+	if passwordPolicy.MaxLength > 0 && length > passwordPolicy.MaxLength {
+		err.Add("password", fmt.Sprintf("is too long (maximum is %d characters)", passwordPolicy.MaxLength))
+		return
+	}
+	lower := strings.ToLower(password)
+	if bannedPasswords[lower] {
+		err.Add("password", "is too common")
+		return
+	}
+	if lower == strings.ToLower(email) || lower == strings.ToLower(username) {
+		err.Add("password", "can't be the same as email or username")
+		return
+	}
+	breached, breachedErr := auth.IsBreachedPassword(passwordPolicy.BreachedDir, password)
+	if breachedErr != nil {
+		// a broken corpus should not stop people from signing up
+		log.Printf("could not check breached passwords: %s", breachedErr)
+	}
+	if breached {
+		err.Add("password", "has appeared in a data breach, choose another one")
+	}
+}
@@ -0,0 +1,167 @@
+package domain
+
+import (
+	"../api_errors"
+	"../auth"
+	"../mail"
+	"../models"
+	"../utils"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const passwordResetTTL = time.Hour
+
+// Reset requests are counted in the sign in throttle table per email and per client address,
+// whether the email is registered or not
+const (
+	passwordResetWindow     = time.Hour
+	passwordResetsPerEmail  = 3
+	passwordResetsPerClient = 10
+	passwordResetQueueSize  = 100
+)
+
+// Reset mails are sent one at a time by a single worker, requests beyond the queue are dropped
+var (
+	passwordResetQueue = make(chan string, passwordResetQueueSize)
+	passwordResetOnce  sync.Once
+)
+
+func passwordResetWorker() {
+	for email := range passwordResetQueue {
+		sendPasswordReset(email)
+	}
+}
+
+// Counts a reset request for key and tells whether it is over max within the window
+func passwordResetThrottled(key string, max uint) bool {
+	count, err := models.RecordLoginFailure(key, passwordResetWindow)
+	if err != nil {
+		log.Printf("could not count password reset request: %s", err)
+		return false
+	}
+	return count > max
+}
+
+type PasswordForgot struct {
+	Email string `json:"email"`
+}
+
+type PasswordReset struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func hashPassword(password string) (string, *api_errors.E) {
+	hash, err := auth.PasswordToHash(password)
+	if errors.Is(err, auth.ErrPasswordTooLong) || errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", api_errors.NewError(http.StatusUnprocessableEntity).Add("password", "is too long")
+	}
+	if err != nil {
+		return "", api_errors.NewError(http.StatusInternalServerError).Add("password", "could not hash password")
+	}
+	return hash, nil
+}
+
+// Stores the hash made by the current hasher after a successful sign in, if the old one is outdated
+func upgradePasswordHash(user *models.User, password string) {
+	if !auth.PasswordNeedsRehash(user.PasswordHash) {
+		return
+	}
+	hash, err := auth.PasswordToHash(password)
+	if err != nil {
+		log.Printf("could not rehash password: %s", err)
+		return
+	}
+	updateErr := models.UpdatePasswordHash(user.ID, user.PasswordHash, hash)
+	if updateErr != nil {
+		log.Printf("could not save rehashed password: %s", updateErr)
+		return
+	}
+	user.PasswordHash = hash
+}
+
+// Mails a reset link. Responds the same way and just as fast whether the email is registered or not,
+// so it can not be used to find out who has an account. Failures are only logged
+func ForgotPassword(f PasswordForgot, client Client) *api_errors.E {
+	if f.Email == "" {
+		return api_errors.NewError(http.StatusUnprocessableEntity).Add("email", "can't be blank")
+	}
+	throttled := api_errors.NewError(http.StatusTooManyRequests).Add("body", "too many password reset requests, try again later").
+		SetHeader("Retry-After", retryAfter(time.Now().Add(passwordResetWindow)))
+	if client.IP != "" && passwordResetThrottled("reset:ip:"+client.IP, passwordResetsPerClient) {
+		return throttled
+	}
+	if passwordResetThrottled("reset:"+accountThrottleKey(f.Email), passwordResetsPerEmail) {
+		return throttled
+	}
+
+	passwordResetOnce.Do(func() { go passwordResetWorker() })
+	select {
+	case passwordResetQueue <- f.Email:
+	default:
+		log.Printf("password reset queue is full, request is dropped")
+	}
+	return nil
+}
+
+func sendPasswordReset(email string) {
+	user, userErr := models.GetUser(email)
+	if userErr != nil {
+		return
+	}
+
+	token := auth.RandomToken(32)
+	err := models.CreatePasswordReset(user.ID, auth.HashToken(token), time.Now().Add(passwordResetTTL))
+	if err != nil {
+		log.Printf("could not create password reset: %s", err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", utils.AppURL(), url.QueryEscape(token))
+	mailErr := mail.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Conduit password",
+		Body: fmt.Sprintf(
+			"Somebody asked to reset the password of your Conduit account %s.\n\n"+
+				"Follow this link within %s to choose a new password:\n%s\n\n"+
+				"If it was not you, ignore this message, your password stays the same.",
+			user.Username, passwordResetTTL, link,
+		),
+	})
+	if mailErr != nil {
+		log.Printf("could not send password reset mail: %s", mailErr)
+	}
+}
+
+// Sets a new password with a reset token and signs the user in. Previous sessions are signed out
+func ResetPassword(r PasswordReset, client Client) (*UserResponse, *api_errors.E) {
+	validationErr := api_errors.NewValidationError()
+	validatePassword(r.Password, "", "", validationErr)
+	if validationErr.HasErrors() {
+		return nil, validationErr
+	}
+	passwordHash, hashErr := hashPassword(r.Password)
+	if hashErr != nil {
+		return nil, hashErr
+	}
+	user, err := models.ResetPassword(auth.HashToken(r.Token), passwordHash)
+	if err != nil {
+		return nil, api_errors.NewError(http.StatusUnauthorized).Add("token", "reset token is invalid or expired")
+	}
+	clearLoginFailures(user.Email)
+	auditClient(AuditPasswordReset, client, user, user.Email, OutcomeSuccess, "")
+
+	tokenString, refreshToken, tokenErr := issueTokens(user, client)
+	if tokenErr != nil {
+		return nil, tokenErr
+	}
+	response := userToResponse(user, tokenString, refreshToken)
+	return &response, nil
+}
@@ -0,0 +1,128 @@
+package domain_test
+
+import (
+	"../DB"
+	"../domain"
+	"../mail"
+	"fmt"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (m *recordingMailer) Send(message mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, message)
+	return nil
+}
+
+// Messages sent so far, waiting up to timeout for at least n of them when they are sent in the background
+func (m *recordingMailer) waitFor(n int, timeout time.Duration) []mail.Message {
+	deadline := time.Now().Add(timeout)
+	for {
+		m.mu.Lock()
+		sent := append([]mail.Message{}, m.sent...)
+		m.mu.Unlock()
+		if len(sent) >= n || time.Now().After(deadline) {
+			return sent
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+}
+
+var linkTokenRe = regexp.MustCompile(`token=([A-Za-z0-9_\-%]+)`)
+
+func TestResetPassword(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createUser(t)
+	defer destroyUser()
+	mailer := &recordingMailer{}
+	mail.SetMailer(mailer)
+	defer mail.SetMailer(mail.NewLocalMailer(""))
+	si, _ := domain.SignIn(userSignIn, testClient)
+
+	err := domain.ForgotPassword(domain.PasswordForgot{Email: userCreate.Email}, testClient)
+	if err != nil {
+		t.Fatalf("could not request password reset: %s", err)
+	}
+	sent := mailer.waitFor(1, time.Second*5)
+	if len(sent) != 1 || sent[0].To != userCreate.Email {
+		t.Fatalf("password reset mail was not sent")
+	}
+	match := linkTokenRe.FindStringSubmatch(sent[0].Body)
+	if match == nil {
+		t.Fatalf("password reset mail has no token: %s", sent[0].Body)
+	}
+
+	newPassword := "sdfgsdfgsdfg"
+	_, resetErr := domain.ResetPassword(domain.PasswordReset{Token: match[1], Password: newPassword}, testClient)
+	if resetErr != nil {
+		t.Fatalf("could not reset password: %s", resetErr)
+	}
+	_, reuseErr := domain.ResetPassword(domain.PasswordReset{Token: match[1], Password: "otherpassword"}, testClient)
+	if reuseErr == nil {
+		t.Fatalf("reset token was accepted twice")
+	}
+	if domain.CheckToken(si.Token, domain.ScopeRead) == nil {
+		t.Fatalf("session from before password reset is still valid")
+	}
+	_, signInErr := domain.SignIn(domain.UserSignIn{Email: userCreate.Email, Password: newPassword}, testClient)
+	if signInErr != nil {
+		t.Fatalf("could not sign in with new password: %s", signInErr)
+	}
+}
+
+func TestForgotPasswordForUnknownEmail(t *testing.T) {
+	initDb()
+	defer closeDb()
+	mailer := &recordingMailer{}
+	mail.SetMailer(mailer)
+	defer mail.SetMailer(mail.NewLocalMailer(""))
+	defer DB.Get().Exec("DELETE FROM login_throttles WHERE key = 'reset:email:nobody@nowhere'")
+
+	err := domain.ForgotPassword(domain.PasswordForgot{Email: "nobody@nowhere"}, testClient)
+	if err != nil {
+		t.Fatalf("unknown email should not be reported: %s", err)
+	}
+	if len(mailer.waitFor(1, time.Millisecond*500)) != 0 {
+		t.Fatalf("mail was sent for unknown email")
+	}
+}
+
+func TestForgotPasswordIsThrottled(t *testing.T) {
+	initDb()
+	defer closeDb()
+	mailer := &recordingMailer{}
+	mail.SetMailer(mailer)
+	defer mail.SetMailer(mail.NewLocalMailer(""))
+	client := domain.Client{IP: "192.0.2.20"}
+	defer DB.Get().Exec("DELETE FROM login_throttles WHERE key IN ('reset:email:nobody@nowhere', 'reset:ip:192.0.2.20')")
+
+	forgot := domain.PasswordForgot{Email: "nobody@nowhere"}
+	for i := 0; i < 3; i++ {
+		err := domain.ForgotPassword(forgot, client)
+		if err != nil {
+			t.Fatalf("reset request %d was refused: %s", i+1, err)
+		}
+	}
+	err := domain.ForgotPassword(forgot, client)
+	if err == nil {
+		t.Fatalf("unlimited reset requests for one email")
+	}
+	for i := 0; i < 10; i++ {
+		domain.ForgotPassword(domain.PasswordForgot{Email: fmt.Sprintf("nobody%d@nowhere", i)}, client)
+		defer DB.Get().Exec(fmt.Sprintf("DELETE FROM login_throttles WHERE key = 'reset:email:nobody%d@nowhere'", i))
+	}
+	err = domain.ForgotPassword(domain.PasswordForgot{Email: "somebody@nowhere"}, client)
+	if err == nil {
+		t.Fatalf("unlimited reset requests from one client")
+	}
+}
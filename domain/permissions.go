@@ -0,0 +1,92 @@
+package domain
+
+import (
+	"../api_errors"
+	"../models"
+	"fmt"
+	"net/http"
+)
+
+// Permissions granted by role. Users can always manage their own content,
+// content permissions are only checked when the user is not the author
+const (
+	PermissionUpdateAnyArticle = "articles:update:any"
+	PermissionDeleteAnyArticle = "articles:delete:any"
+	PermissionDeleteAnyComment = "comments:delete:any"
+	PermissionManageRoles      = "roles:manage"
+	PermissionViewAuditLog     = "audit:read"
+)
+
+var moderatorPermissions = []string{
+	PermissionUpdateAnyArticle,
+	PermissionDeleteAnyArticle,
+	PermissionDeleteAnyComment,
+}
+
+var rolePermissions = map[string][]string{
+	models.RoleUser:      {},
+	models.RoleModerator: moderatorPermissions,
+	models.RoleAdmin:     append([]string{PermissionManageRoles, PermissionViewAuditLog}, moderatorPermissions...),
+}
+
+func can(user *models.User, permission string) bool {
+	for _, p := range rolePermissions[user.Role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows the author of the content, or a user whose role has permission
+func authorize(user *models.User, authorID uint, permission string, message string) *api_errors.E {
+	if user.ID == authorID || can(user, permission) {
+		return nil
+	}
+	return api_errors.NewError(http.StatusForbidden).Add("token", message)
+}
+
+type RoleUpdate struct {
+	Role string `json:"role"`
+}
+
+type UserRole struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+func isRole(role string) bool {
+	for _, r := range models.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func SetUserRole(username string, update RoleUpdate, actor *Actor) (*UserRole, *api_errors.E) {
+	admin, adminErr := actor.user(ScopeSession)
+	if adminErr != nil {
+		return nil, adminErr
+	}
+	if !can(admin, PermissionManageRoles) {
+		return nil, api_errors.NewError(http.StatusForbidden).Add("token", "only admins can change roles")
+	}
+	if !isRole(update.Role) {
+		return nil, api_errors.NewError(http.StatusUnprocessableEntity).Add("role", fmt.Sprintf("%s is not a valid role", update.Role))
+	}
+	user, userErr := models.GetUserByUsername(username)
+	if userErr != nil {
+		return nil, api_errors.NewError(http.StatusNotFound).Add("username", "user not found")
+	}
+	if user.ID == admin.ID {
+		// keeps the last admin from locking everyone out
+		return nil, api_errors.NewError(http.StatusForbidden).Add("role", "can not change own role")
+	}
+	err := models.SetUserRole(user.ID, update.Role)
+	if err != nil {
+		return nil, api_errors.NewError(http.StatusInternalServerError).Add("role", "could not change role")
+	}
+	auditActor(AuditRoleChange, actor, user, user.Role+" -> "+update.Role)
+	return &UserRole{Username: user.Username, Role: update.Role}, nil
+}
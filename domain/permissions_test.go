@@ -0,0 +1,144 @@
+package domain_test
+
+import (
+	"../DB"
+	"../domain"
+	"../models"
+	"fmt"
+	"testing"
+)
+
+var moderatorCreate = domain.UserCreate{
+	Email:    "m22@m",
+	Password: "fretewrts",
+	Username: "m54tersdfg",
+}
+
+func destroyModerator() {
+	var user models.User
+	DB.Get().Where(&models.User{Email: moderatorCreate.Email}).First(&user)
+	DB.Get().Exec(fmt.Sprintf("DELETE FROM users WHERE email = '%s'", moderatorCreate.Email))
+	DB.Get().Exec(fmt.Sprintf("DELETE FROM refresh_tokens WHERE user_id = '%d'", user.ID))
+	DB.Get().Exec(fmt.Sprintf("DELETE FROM sessions WHERE user_id = '%d'", user.ID))
+	DB.Get().Exec(fmt.Sprintf("DELETE FROM audit_events WHERE user_id = '%d'", user.ID))
+}
+
+func TestModeratorCanDeleteOtherArticles(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createArticle(t)
+	defer destroyArticle()
+	moderator, createErr := domain.CreateUser(moderatorCreate, testClient)
+	defer destroyModerator()
+	if createErr != nil {
+		t.Fatalf("could not create moderator: %s", createErr)
+	}
+	if moderator.Role != models.RoleUser {
+		t.Fatalf("new user has role %s", moderator.Role)
+	}
+	slug := domain.SlugFromTitle(articleCreate.Title)
+
+	err := domain.DeleteArticle(slug, identify(moderator.Token))
+	if err == nil {
+		t.Fatalf("user deleted article of another user")
+	}
+
+	stored, _ := models.GetUser(moderatorCreate.Email)
+	roleErr := models.SetUserRole(stored.ID, models.RoleModerator)
+	if roleErr != nil {
+		t.Fatalf("could not set role: %s", roleErr)
+	}
+	err = domain.DeleteArticle(slug, identify(moderator.Token))
+	if err != nil {
+		t.Fatalf("moderator could not delete article: %s", err)
+	}
+}
+
+func TestModeratorEditKeepsAuthor(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createArticle(t)
+	defer destroyArticle()
+	moderator, createErr := domain.CreateUser(moderatorCreate, testClient)
+	defer destroyModerator()
+	if createErr != nil {
+		t.Fatalf("could not create moderator: %s", createErr)
+	}
+	stored, _ := models.GetUser(moderatorCreate.Email)
+	roleErr := models.SetUserRole(stored.ID, models.RoleModerator)
+	if roleErr != nil {
+		t.Fatalf("could not set role: %s", roleErr)
+	}
+	slug := domain.SlugFromTitle(articleCreate.Title)
+
+	update := map[string]interface{}{
+		"title":       articleCreate.Title,
+		"body":        "edited by moderator",
+		"description": articleCreate.Description,
+	}
+	result, err := domain.UpdateArticle(slug, update, identify(moderator.Token))
+	if err != nil {
+		t.Fatalf("moderator could not edit article: %s", err)
+	}
+	if result.Author.Username != userCreate.Username {
+		t.Fatalf("moderator edit changed author to %s", result.Author.Username)
+	}
+	article, _ := models.GetArticle(slug)
+	author, _ := models.GetUser(userCreate.Email)
+	if article.AuthorID != author.ID {
+		t.Fatalf("stored author changed after moderator edit")
+	}
+}
+
+func TestOnlyAdminsSetRoles(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createUser(t)
+	defer destroyUser()
+	moderator, _ := domain.CreateUser(moderatorCreate, testClient)
+	defer destroyModerator()
+
+	update := domain.RoleUpdate{Role: models.RoleModerator}
+	_, err := domain.SetUserRole(userCreate.Username, update, identify(moderator.Token))
+	if err == nil {
+		t.Fatalf("user without admin role changed a role")
+	}
+
+	stored, _ := models.GetUser(moderatorCreate.Email)
+	models.SetUserRole(stored.ID, models.RoleAdmin)
+	result, err := domain.SetUserRole(userCreate.Username, update, identify(moderator.Token))
+	if err != nil {
+		t.Fatalf("admin could not change role: %s", err)
+	}
+	if result.Role != models.RoleModerator {
+		t.Fatalf("role is %s after update", result.Role)
+	}
+	user, _ := domain.SignIn(userSignIn, testClient)
+	if user.Role != models.RoleModerator {
+		t.Fatalf("signed in user has role %s", user.Role)
+	}
+}
+
+func TestAdminEmailsNeedVerifiedEmail(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createUser(t)
+	defer destroyUser()
+	emails := []string{userCreate.Email, "nobody@example.com"}
+
+	skipped, err := models.SetRoleByEmails(emails, models.RoleAdmin)
+	if err != nil {
+		t.Fatalf("could not set admins: %s", err)
+	}
+	stored, _ := models.GetUser(userCreate.Email)
+	if stored.Role != models.RoleUser || len(skipped) != 2 {
+		t.Fatalf("user with unverified email was made admin")
+	}
+
+	_, _ = models.SetEmailVerified(stored.ID, stored.Email)
+	skipped, _ = models.SetRoleByEmails(emails, models.RoleAdmin)
+	stored, _ = models.GetUser(userCreate.Email)
+	if stored.Role != models.RoleAdmin || len(skipped) != 1 || skipped[0] != "nobody@example.com" {
+		t.Fatalf("user with verified email was not made admin, skipped %v", skipped)
+	}
+}
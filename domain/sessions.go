@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"../api_errors"
+	"../models"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Last seen is written at most this often per session, so authenticated requests do not all write to db
+const sessionTouchInterval = time.Minute
+
+var sessionTouches = struct {
+	sync.Mutex
+	seen  map[string]time.Time
+	swept time.Time
+}{seen: map[string]time.Time{}}
+
+type SessionResponse struct {
+	ID         string `json:"id"`
+	UserAgent  string `json:"userAgent"`
+	IP         string `json:"ip"`
+	CreatedAt  string `json:"createdAt"`
+	LastSeenAt string `json:"lastSeenAt"`
+	// session of the token the request was made with
+	Current bool `json:"current"`
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+func touchSession(id string) {
+	now := time.Now()
+	sessionTouches.Lock()
+	if last, found := sessionTouches.seen[id]; found && now.Sub(last) < sessionTouchInterval {
+		sessionTouches.Unlock()
+		return
+	}
+	sessionTouches.seen[id] = now
+	if now.Sub(sessionTouches.swept) > sessionTouchInterval {
+		for s, last := range sessionTouches.seen {
+			if now.Sub(last) >= sessionTouchInterval {
+				delete(sessionTouches.seen, s)
+			}
+		}
+		sessionTouches.swept = now
+	}
+	sessionTouches.Unlock()
+
+	err := models.TouchSession(id, sessionTouchInterval)
+	if err != nil {
+		log.Printf("could not update session last seen: %s", err)
+	}
+}
+
+func ListSessions(actor *Actor) (*[]SessionResponse, *api_errors.E) {
+	user, userErr := actor.user(ScopeSession)
+	if userErr != nil {
+		return nil, userErr
+	}
+	sessions, err := models.ListSessions(user.ID)
+	if err != nil {
+		return nil, api_errors.NewError(http.StatusInternalServerError).Add("sessions", "could not get sessions")
+	}
+	result := []SessionResponse{}
+	for _, s := range *sessions {
+		result = append(result, SessionResponse{
+			ID:         s.ID,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			CreatedAt:  formatTime(s.CreatedAt),
+			LastSeenAt: formatTime(s.LastSeenAt),
+			Current:    actor.session() == s.ID,
+		})
+	}
+	return &result, nil
+}
+
+// Signs the session out, its access tokens stop working at once and its refresh token can not be used
+func DeleteSession(id string, actor *Actor) *api_errors.E {
+	user, userErr := actor.user(ScopeSession)
+	if userErr != nil {
+		return userErr
+	}
+	deleted, err := models.DeleteSession(user.ID, id)
+	if err != nil {
+		return api_errors.NewError(http.StatusInternalServerError).Add("session", "could not delete session")
+	}
+	if !deleted {
+		return api_errors.NewError(http.StatusNotFound).Add("session", "session not found")
+	}
+	auditActor(AuditSessionRevoke, actor, user, id)
+	return nil
+}
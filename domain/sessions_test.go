@@ -0,0 +1,48 @@
+package domain_test
+
+import (
+	"../domain"
+	"testing"
+)
+
+func TestDeleteSession(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createUser(t)
+	defer destroyUser()
+	phone := domain.Client{IP: "192.0.2.20", UserAgent: "phone"}
+	old, _ := domain.SignIn(userSignIn, phone)
+	current, _ := domain.SignIn(userSignIn, testClient)
+
+	sessions, err := domain.ListSessions(identify(current.Token))
+	if err != nil {
+		t.Fatalf("could not list sessions: %s", err)
+	}
+	var oldID string
+	for _, s := range *sessions {
+		if s.UserAgent == phone.UserAgent && s.IP == phone.IP {
+			oldID = s.ID
+		}
+		if s.Current && s.UserAgent == phone.UserAgent {
+			t.Fatalf("other session is marked as current")
+		}
+	}
+	if oldID == "" {
+		t.Fatalf("session of the phone is not listed: %+v", *sessions)
+	}
+
+	deleteErr := domain.DeleteSession(oldID, identify(current.Token))
+	if deleteErr != nil {
+		t.Fatalf("could not delete session: %s", deleteErr)
+	}
+	if domain.CheckToken(old.Token, domain.ScopeRead) == nil {
+		t.Fatalf("token of deleted session is still valid")
+	}
+	_, refreshErr := domain.RefreshToken(domain.TokenRefresh{RefreshToken: old.RefreshToken})
+	if refreshErr == nil {
+		t.Fatalf("refresh token of deleted session still works")
+	}
+	if domain.CheckToken(current.Token, domain.ScopeRead) != nil {
+		t.Fatalf("current session was signed out")
+	}
+}
@@ -33,8 +33,17 @@ var userSignIn domain.UserSignIn = domain.UserSignIn{
 	Password: userCreate.Password,
 }
 
+// Actor of the token, nil for an invalid token as for anonymous requests
+func identify(tokenString string) *domain.Actor {
+	actor, _ := domain.Authenticate(tokenString, testClient)
+	return actor
+}
+
+// No address, so tests do not share a client sign in throttle
+var testClient = domain.Client{}
+
 func createUser(t *testing.T) {
-	_, err := domain.CreateUser(userCreate)
+	_, err := domain.CreateUser(userCreate, testClient)
 	if err != nil {
 		t.Fatalf("could not create user: %s", err)
 	}
@@ -46,6 +55,16 @@ func destroyUser() {
 	DB.Get().Exec(fmt.Sprintf("DELETE FROM users WHERE email = '%s'", userCreate.Email))
 	DB.Get().Exec(fmt.Sprintf("DELETE FROM follows WHERE following_id = '%d'", user.ID))
 	DB.Get().Exec(fmt.Sprintf("DELETE FROM follows WHERE followed_by_id = '%d'", user.ID))
+	DB.Get().Exec(fmt.Sprintf("DELETE FROM refresh_tokens WHERE user_id = '%d'", user.ID))
+	DB.Get().Exec(fmt.Sprintf("DELETE FROM sessions WHERE user_id = '%d'", user.ID))
+	DB.Get().Exec(fmt.Sprintf("DELETE FROM password_resets WHERE user_id = '%d'", user.ID))
+	DB.Get().Exec(fmt.Sprintf("DELETE FROM recovery_codes WHERE user_id = '%d'", user.ID))
+	DB.Get().Exec(fmt.Sprintf("DELETE FROM access_tokens WHERE user_id = '%d'", user.ID))
+	DB.Get().Exec(fmt.Sprintf("DELETE FROM data_exports WHERE user_id = '%d'", user.ID))
+	DB.Get().Exec(fmt.Sprintf("DELETE FROM notification_actors WHERE notification_id IN (SELECT id FROM notifications WHERE user_id = '%d')", user.ID))
+	DB.Get().Exec(fmt.Sprintf("DELETE FROM notifications WHERE user_id = '%d'", user.ID))
+	DB.Get().Exec(fmt.Sprintf("DELETE FROM login_throttles WHERE key IN ('email:%[1]s', 'reset:email:%[1]s')", userCreate.Email))
+	DB.Get().Exec(fmt.Sprintf("DELETE FROM audit_events WHERE user_id = '%d' OR email = '%s'", user.ID, userCreate.Email))
 
 }
 
@@ -58,9 +77,9 @@ var articleCreate = domain.ArticleCreate{
 
 func createArticle(t *testing.T) {
 	createUser(t)
-	userResponse, _ := domain.SignIn(userSignIn)
+	userResponse, _ := domain.SignIn(userSignIn, testClient)
 	tokenString := userResponse.Token
-	_, err := domain.CreateArticle(articleCreate, tokenString)
+	_, err := domain.CreateArticle(articleCreate, identify(tokenString))
 	if err != nil {
 		t.Fatalf("could not create article: %s", err)
 	}
@@ -0,0 +1,207 @@
+package domain
+
+import (
+	"../api_errors"
+	"../auth"
+	"../models"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type TokenRefresh struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// Starts a new session for the user and returns access and refresh tokens for it
+func issueTokens(user *models.User, client Client) (string, string, *api_errors.E) {
+	now := time.Now()
+	session := models.Session{
+		ID:         auth.RandomToken(16),
+		UserID:     user.ID,
+		UserAgent:  truncate(client.UserAgent, 512),
+		IP:         client.IP,
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+	refreshToken := auth.RandomToken(32)
+	err := models.CreateSession(&session, auth.HashToken(refreshToken), now.Add(auth.RefreshTokenTTL()))
+	if err != nil {
+		return "", "", api_errors.NewError(http.StatusInternalServerError).Add("token", "could not issue refresh token")
+	}
+	return auth.GetTokenString(user.ID, user.Email, session.ID, user.Role), refreshToken, nil
+}
+
+func RefreshToken(r TokenRefresh) (*UserResponse, *api_errors.E) {
+	invalid := api_errors.NewError(http.StatusUnauthorized).Add("refreshToken", "refresh token is invalid")
+	if r.RefreshToken == "" {
+		return nil, invalid
+	}
+	stored, err := models.GetRefreshToken(auth.HashToken(r.RefreshToken))
+	if err != nil || stored.RevokedAt != nil || stored.ExpiresAt.Before(time.Now()) {
+		return nil, invalid
+	}
+	if stored.UsedAt != nil {
+		// a used refresh token is presented again, someone else has a copy of it
+		_ = models.RevokeRefreshFamily(stored.Family)
+		return nil, invalid
+	}
+
+	user, userErr := models.GetUserByID(stored.UserID)
+	if userErr != nil {
+		return nil, invalid
+	}
+
+	refreshToken := auth.RandomToken(32)
+	rotateErr := models.RotateRefreshToken(stored, auth.HashToken(refreshToken), time.Now().Add(auth.RefreshTokenTTL()))
+	if rotateErr != nil {
+		return nil, invalid
+	}
+
+	response := userToResponse(user, auth.GetTokenString(user.ID, user.Email, stored.Family, user.Role), refreshToken)
+	return &response, nil
+}
+
+// Revokes the presented access token and the refresh token family it belongs to
+func Logout(actor *Actor) *api_errors.E {
+	err := actor.Require(ScopeSession)
+	if err != nil {
+		return err
+	}
+	claims := actor.claims
+	if claims.Family != "" {
+		famErr := models.RevokeRefreshFamily(claims.Family)
+		if famErr != nil {
+			return api_errors.NewError(http.StatusInternalServerError).Add("token", "could not revoke refresh tokens")
+		}
+	}
+	revokeErr := models.RevokeToken(claims.Id, time.Unix(claims.ExpiresAt, 0))
+	if revokeErr != nil {
+		return api_errors.NewError(http.StatusInternalServerError).Add("token", "could not revoke token")
+	}
+	_ = models.PurgeExpiredTokens()
+	auditActor(AuditSignOut, actor, actor.User, "")
+	return nil
+}
+
+// Scopes a personal access token can be granted.
+// Session tokens from sign in have all of them and ScopeSession, which is never granted to personal access tokens,
+// so account settings can not be changed by automation
+const (
+	ScopeRead          = "read"
+	ScopeArticlesWrite = "articles:write"
+	ScopeCommentsWrite = "comments:write"
+	ScopeProfilesWrite = "profiles:write"
+	ScopeSession       = "session"
+)
+
+var grantableScopes = []string{ScopeRead, ScopeArticlesWrite, ScopeCommentsWrite, ScopeProfilesWrite}
+
+// Who makes a request, resolved from the token once per request by Authenticate.
+// Nil actor is an anonymous request
+type Actor struct {
+	User   *models.User
+	Token  string
+	Client Client
+	// claims of a session token, nil for personal access tokens
+	claims *auth.Claims
+	// scopes of a personal access token
+	scopes string
+}
+
+// Email tokens issued before tokens had user id as subject are accepted until then, zero refuses them
+var emailTokensAcceptedUntil time.Time
+
+func SetEmailTokensAcceptedUntil(t time.Time) {
+	emailTokensAcceptedUntil = t
+}
+
+func sessionUser(claims *auth.Claims) (*models.User, *api_errors.E) {
+	invalid := api_errors.NewError(http.StatusUnauthorized).Add("token", "token is invalid")
+	if id, ok := claims.UserID(); ok {
+		user, err := models.GetUserByID(id)
+		if err != nil {
+			return nil, invalid
+		}
+		return user, nil
+	}
+	if time.Now().After(emailTokensAcceptedUntil) {
+		return nil, api_errors.NewError(http.StatusUnauthorized).Add("token", "token is outdated, sign in again")
+	}
+	user, err := models.GetUser(claims.Email)
+	if err != nil {
+		return nil, invalid
+	}
+	return user, nil
+}
+
+// Resolves the user a session or personal access token belongs to, scopes are checked with Require
+func Authenticate(tokenString string, client Client) (*Actor, *api_errors.E) {
+	if auth.IsAccessTokenString(tokenString) {
+		return authenticateAccessToken(tokenString, client)
+	}
+	claims, err := auth.GetClaimsFromTokenString(tokenString)
+	if err != nil {
+		return nil, api_errors.NewError(http.StatusUnauthorized).Add("token", "token is invalid")
+	}
+	if claims.Id != "" && models.IsTokenRevoked(claims.Id) {
+		return nil, api_errors.NewError(http.StatusUnauthorized).Add("token", "token was revoked")
+	}
+	if claims.Family != "" && models.IsRefreshFamilyRevoked(claims.Family) {
+		return nil, api_errors.NewError(http.StatusUnauthorized).Add("token", "token was revoked")
+	}
+	user, userErr := sessionUser(claims)
+	if userErr != nil {
+		return nil, userErr
+	}
+	if claims.Family != "" {
+		touchSession(claims.Family)
+	}
+	return &Actor{User: user, Token: tokenString, Client: client, claims: claims}, nil
+}
+
+// Checks that the actor is signed in with a token that allows scope.
+// Session tokens allow every scope, personal access tokens only those they were granted
+func (a *Actor) Require(scope string) *api_errors.E {
+	if a == nil || a.User == nil {
+		return api_errors.NewError(http.StatusUnauthorized).Add("token", "token is required")
+	}
+	if a.claims == nil && !hasScope(a.scopes, scope) {
+		return api_errors.NewError(http.StatusForbidden).Add("token", fmt.Sprintf("token does not have %s scope", scope))
+	}
+	return nil
+}
+
+func (a *Actor) user(scope string) (*models.User, *api_errors.E) {
+	err := a.Require(scope)
+	if err != nil {
+		return nil, err
+	}
+	return a.User, nil
+}
+
+// Refresh token family the session token belongs to, empty for personal access tokens
+func (a *Actor) session() string {
+	if a == nil || a.claims == nil {
+		return ""
+	}
+	return a.claims.Family
+}
+
+// User of an optional token, nil when request is anonymous or token can not read
+func viewer(a *Actor) *models.User {
+	user, err := a.user(ScopeRead)
+	if err != nil {
+		return nil
+	}
+	return user
+}
+
+// Checks token signature and expiration, that it was not revoked since it was issued and that it allows scope
+func CheckToken(tokenString string, scope string) *api_errors.E {
+	actor, err := Authenticate(tokenString, Client{})
+	if err != nil {
+		return err
+	}
+	return actor.Require(scope)
+}
@@ -0,0 +1,172 @@
+package domain
+
+import (
+	"../api_errors"
+	"../auth"
+	"../models"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const twoFactorChallengeTTL = time.Minute * 5
+
+const recoveryCodeCount = 10
+
+const totpIssuer = "Conduit"
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// Either a code from the authenticator or one of the recovery codes
+type TwoFactorCode struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type TwoFactorSignIn struct {
+	ChallengeToken string `json:"challengeToken"`
+	TwoFactorCode
+}
+
+func checkTOTP(user *models.User, code string) bool {
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return false
+	}
+	// a code can be used only once, even within its time step
+	fresh, err := models.UseTOTPStep(user.ID, step)
+	return err == nil && fresh
+}
+
+func checkSecondFactor(user *models.User, c TwoFactorCode) bool {
+	if c.Code != "" {
+		return checkTOTP(user, c.Code)
+	}
+	if c.RecoveryCode != "" {
+		used, err := models.UseRecoveryCode(user.ID, auth.HashToken(auth.NormalizeRecoveryCode(c.RecoveryCode)))
+		return err == nil && used
+	}
+	return false
+}
+
+// Instead of tokens, sign in with two factor enabled responds with a short lived challenge
+// that is exchanged for tokens together with a code in SignInTwoFactor
+func twoFactorChallenge(user *models.User) UserResponse {
+	return UserResponse{
+		TwoFactorRequired: true,
+		ChallengeToken: auth.GetPurposeTokenString(
+			auth.PurposeTwoFactorChallenge, strconv.Itoa(int(user.ID)), user.Email, twoFactorChallengeTTL,
+		),
+	}
+}
+
+func SignInTwoFactor(s TwoFactorSignIn, client Client) (UserResponse, *api_errors.E) {
+	invalid := api_errors.NewError(http.StatusUnauthorized).Add("code", "two factor code is invalid")
+	claims, err := auth.GetPurposeClaims(s.ChallengeToken, auth.PurposeTwoFactorChallenge)
+	if err != nil {
+		return UserResponse{}, api_errors.NewError(http.StatusUnauthorized).Add("challengeToken", "challenge is invalid or expired")
+	}
+	userID, idErr := strconv.Atoi(claims.Subject)
+	if idErr != nil {
+		return UserResponse{}, invalid
+	}
+	user, userErr := models.GetUserByID(uint(userID))
+	if userErr != nil || !user.TOTPEnabled {
+		return UserResponse{}, invalid
+	}
+	throttleErr := checkLoginThrottle(user.Email, client)
+	if throttleErr != nil {
+		auditClient(AuditSignIn, client, user, user.Email, OutcomeFailure, "too many failed attempts")
+		return UserResponse{}, throttleErr
+	}
+	if !checkSecondFactor(user, s.TwoFactorCode) {
+		recordLoginFailure(user.Email, user, client)
+		auditClient(AuditSignIn, client, user, user.Email, OutcomeFailure, "wrong second factor")
+		return UserResponse{}, invalid
+	}
+	clearLoginFailures(user.Email)
+
+	tokenString, refreshToken, tokenErr := issueTokens(user, client)
+	if tokenErr != nil {
+		return UserResponse{}, tokenErr
+	}
+	auditClient(AuditSignIn, client, user, user.Email, OutcomeSuccess, "second factor")
+	return userToResponse(user, tokenString, refreshToken), nil
+}
+
+// Generates a new secret, two factor sign in stays off until ConfirmTOTP
+func EnrollTOTP(actor *Actor) (*TOTPEnrollment, *api_errors.E) {
+	user, userErr := actor.user(ScopeSession)
+	if userErr != nil {
+		return nil, userErr
+	}
+	if user.TOTPEnabled {
+		return nil, api_errors.NewError(http.StatusUnprocessableEntity).Add("totp", "is already enabled")
+	}
+
+	secret := auth.GenerateTOTPSecret()
+	err := models.SetPendingTOTPSecret(user.ID, secret)
+	if err != nil {
+		return nil, api_errors.NewError(http.StatusInternalServerError).Add("totp", "could not save secret")
+	}
+	return &TOTPEnrollment{
+		Secret: secret,
+		URI:    auth.TOTPURI(secret, totpIssuer, user.Email),
+	}, nil
+}
+
+// Enables two factor sign in once the user proves the authenticator works, returns recovery codes
+func ConfirmTOTP(c TwoFactorCode, actor *Actor) (*RecoveryCodes, *api_errors.E) {
+	user, userErr := actor.user(ScopeSession)
+	if userErr != nil {
+		return nil, userErr
+	}
+	if user.TOTPEnabled {
+		return nil, api_errors.NewError(http.StatusUnprocessableEntity).Add("totp", "is already enabled")
+	}
+	if user.TOTPSecret == "" {
+		return nil, api_errors.NewError(http.StatusUnprocessableEntity).Add("totp", "enrollment is not started")
+	}
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, c.Code, time.Now())
+	if !ok {
+		return nil, api_errors.NewError(http.StatusUnprocessableEntity).Add("code", "is invalid")
+	}
+
+	codes := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	hashes := []string{}
+	for _, code := range codes {
+		hashes = append(hashes, auth.HashToken(code))
+	}
+	err := models.EnableTOTP(user.ID, step, hashes)
+	if err != nil {
+		return nil, api_errors.NewError(http.StatusInternalServerError).Add("totp", "could not enable two factor sign in")
+	}
+	auditActor(AuditTwoFactorEnable, actor, user, "")
+	return &RecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+func DisableTOTP(c TwoFactorCode, actor *Actor) *api_errors.E {
+	user, userErr := actor.user(ScopeSession)
+	if userErr != nil {
+		return userErr
+	}
+	if !user.TOTPEnabled {
+		return api_errors.NewError(http.StatusUnprocessableEntity).Add("totp", "is not enabled")
+	}
+	if !checkSecondFactor(user, c) {
+		return api_errors.NewError(http.StatusUnprocessableEntity).Add("code", "is invalid")
+	}
+	err := models.DisableTOTP(user.ID)
+	if err != nil {
+		return api_errors.NewError(http.StatusInternalServerError).Add("totp", "could not disable two factor sign in")
+	}
+	auditActor(AuditTwoFactorDisable, actor, user, "")
+	return nil
+}
@@ -0,0 +1,97 @@
+package domain_test
+
+import (
+	"../auth"
+	"../domain"
+	"testing"
+	"time"
+)
+
+func TestTwoFactorSignIn(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createUser(t)
+	defer destroyUser()
+	si, _ := domain.SignIn(userSignIn, testClient)
+
+	enrollment, err := domain.EnrollTOTP(identify(si.Token))
+	if err != nil {
+		t.Fatalf("could not enroll totp: %s", err)
+	}
+	code, _ := auth.TOTPCode(enrollment.Secret, auth.TOTPStep(time.Now()))
+	codes, confirmErr := domain.ConfirmTOTP(domain.TwoFactorCode{Code: code}, identify(si.Token))
+	if confirmErr != nil {
+		t.Fatalf("could not confirm totp: %s", confirmErr)
+	}
+	if len(codes.RecoveryCodes) == 0 {
+		t.Fatalf("no recovery codes after enabling totp")
+	}
+
+	challenge, signInErr := domain.SignIn(userSignIn, testClient)
+	if signInErr != nil {
+		t.Fatalf("could not sign in: %s", signInErr)
+	}
+	if !challenge.TwoFactorRequired || challenge.Token != "" {
+		t.Fatalf("sign in with totp enabled returned token without second factor")
+	}
+
+	_, replayErr := domain.SignInTwoFactor(domain.TwoFactorSignIn{
+		ChallengeToken: challenge.ChallengeToken,
+		TwoFactorCode:  domain.TwoFactorCode{Code: code},
+	}, testClient)
+	if replayErr == nil {
+		t.Fatalf("totp code was accepted twice")
+	}
+
+	recovery := domain.TwoFactorSignIn{
+		ChallengeToken: challenge.ChallengeToken,
+		TwoFactorCode:  domain.TwoFactorCode{RecoveryCode: codes.RecoveryCodes[0]},
+	}
+	result, recoveryErr := domain.SignInTwoFactor(recovery, testClient)
+	if recoveryErr != nil {
+		t.Fatalf("could not sign in with recovery code: %s", recoveryErr)
+	}
+	if result.Token == "" {
+		t.Fatalf("two factor sign in response has no token")
+	}
+	_, reuseErr := domain.SignInTwoFactor(recovery, testClient)
+	if reuseErr == nil {
+		t.Fatalf("recovery code was accepted twice")
+	}
+}
+
+func TestPasswordSignInDoesNotResetTwoFactorLockout(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createUser(t)
+	defer destroyUser()
+	si, _ := domain.SignIn(userSignIn, testClient)
+	enrollment, _ := domain.EnrollTOTP(identify(si.Token))
+	code, _ := auth.TOTPCode(enrollment.Secret, auth.TOTPStep(time.Now()))
+	_, confirmErr := domain.ConfirmTOTP(domain.TwoFactorCode{Code: code}, identify(si.Token))
+	if confirmErr != nil {
+		t.Fatalf("could not confirm totp: %s", confirmErr)
+	}
+
+	wrongCode := func() {
+		challenge, err := domain.SignIn(userSignIn, testClient)
+		if err != nil {
+			t.Fatalf("could not sign in with password: %s", err)
+		}
+		_, codeErr := domain.SignInTwoFactor(domain.TwoFactorSignIn{
+			ChallengeToken: challenge.ChallengeToken,
+			TwoFactorCode:  domain.TwoFactorCode{Code: "000000"},
+		}, testClient)
+		if codeErr == nil {
+			t.Fatalf("wrong two factor code was accepted")
+		}
+	}
+	// every code is guessed after a fresh password sign in
+	for i := 0; i < 5; i++ {
+		wrongCode()
+	}
+	_, lockedErr := domain.SignIn(userSignIn, testClient)
+	if lockedErr == nil {
+		t.Fatalf("password sign in reset the count of wrong two factor codes")
+	}
+}
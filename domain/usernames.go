@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"../api_errors"
+	"../models"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	usernameMinLength = 3
+	usernameMaxLength = 32
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Names that look like they belong to the site or clash with routes, compared case insensitive
+var reservedUsernames = bannedSet([]string{
+	"admin", "administrator", "api", "root", "system", "support", "moderator", "conduit",
+	"user", "users", "profile", "profiles", "article", "articles", "tag", "tags",
+	"login", "logout", "register", "settings", "editor", "me", "null", "undefined",
+	models.DeletedUserUsername,
+})
+
+// Adds an email error to err when email belongs to the deleted user placeholder
+func validateEmail(email string, err *api_errors.E) {
+	if strings.EqualFold(strings.TrimSpace(email), models.DeletedUserEmail) {
+		err.Add("email", "is reserved")
+	}
+}
+
+// Adds username errors to err. exceptUserID is the user being renamed, 0 on sign up
+func validateUsername(username string, exceptUserID uint, err *api_errors.E) {
+	if username == "" {
+		err.Add("username", "can't be blank")
+		return
+	}
+	if len(username) < usernameMinLength {
+		err.Add("username", fmt.Sprintf("is too short (minimum is %d characters)", usernameMinLength))
+		return
+	}
+	if len(username) > usernameMaxLength {
+		err.Add("username", fmt.Sprintf("is too long (maximum is %d characters)", usernameMaxLength))
+		return
+	}
+	if !usernamePattern.MatchString(username) {
+		err.Add("username", "can only contain letters, digits, - and _")
+		return
+	}
+	if reservedUsernames[strings.ToLower(username)] {
+		err.Add("username", "is reserved")
+		return
+	}
+	if models.IsUsernameTaken(username, exceptUserID) {
+		err.Add("username", "has already been taken")
+	}
+}
+
+// Save error for the user, with the spec's message when another user took the username meanwhile
+func saveUserError(err error, field string) *api_errors.E {
+	if err == models.ErrUsernameTaken {
+		return api_errors.NewValidationError().Add("username", "has already been taken")
+	}
+	return api_errors.NewError(http.StatusInternalServerError).Add(field, err.Error())
+}
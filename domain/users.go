@@ -5,6 +5,7 @@ import (
 	"../auth"
 	"../models"
 	"fmt"
+	"log"
 	"net/http"
 )
 
@@ -19,12 +20,25 @@ type UserSignIn struct {
 	Password string `json:"password"`
 }
 
+// Where a request came from, sign in attempts are throttled per client address
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
 type UserResponse struct {
-	Username string  `json:"username"`
-	Email    string  `json:"email"`
-	Bio      string  `json:"bio"`
-	Image    *string `json:"image"`
-	Token    string  `json:"token"`
+	Username      string  `json:"username"`
+	Email         string  `json:"email"`
+	EmailVerified bool    `json:"emailVerified"`
+	Role          string  `json:"role"`
+	Bio           string  `json:"bio"`
+	Image         *string `json:"image"`
+	Private       bool    `json:"private"`
+	Token         string  `json:"token"`
+	RefreshToken  string  `json:"refreshToken,omitempty"`
+
+	TwoFactorRequired bool   `json:"twoFactorRequired,omitempty"`
+	ChallengeToken    string `json:"challengeToken,omitempty"`
 }
 
 type UserUpdate struct {
@@ -33,6 +47,7 @@ type UserUpdate struct {
 	Password *string `json:"password"`
 	Image    *string `json:"image"`
 	Bio      *string `json:"bio"`
+	Private  *bool   `json:"private"`
 }
 
 type Profile struct {
@@ -40,81 +55,138 @@ type Profile struct {
 	Bio       string  `json:"bio"`
 	Image     *string `json:"image"`
 	Following bool    `json:"following"`
+	// viewer asked to follow this private account and waits for approval
+	Requested bool `json:"requested,omitempty"`
+	// only with GetProfileWithStats
+	Stats *ProfileStats `json:"stats,omitempty"`
 }
 
-func CreateUser(u UserCreate) (UserResponse, *api_errors.E) {
+type ProfileStats struct {
+	ArticlesCount  uint `json:"articlesCount"`
+	FavoritesCount uint `json:"favoritesCount"`
+	FollowersCount uint `json:"followersCount"`
+	FollowingCount uint `json:"followingCount"`
+	// empty for accounts older than the record of it
+	MemberSince string `json:"memberSince,omitempty"`
+}
+
+func userToResponse(user *models.User, token string, refreshToken string) UserResponse {
+	return UserResponse{
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Role:          user.Role,
+		Bio:           user.Bio,
+		Image:         user.Image,
+		Private:       user.Private,
+		Token:         token,
+		RefreshToken:  refreshToken,
+	}
+}
+
+func CreateUser(u UserCreate, client Client) (UserResponse, *api_errors.E) {
+	validationErr := api_errors.NewValidationError()
+	validateUsername(u.Username, 0, validationErr)
+	validateEmail(u.Email, validationErr)
+	validatePassword(u.Password, u.Email, u.Username, validationErr)
+	if validationErr.HasErrors() {
+		return UserResponse{}, validationErr
+	}
+
+	passwordHash, hashErr := hashPassword(u.Password)
+	if hashErr != nil {
+		return UserResponse{}, hashErr
+	}
 	user := models.User{
 		Username:     u.Username,
-		PasswordHash: auth.PasswordToHash(u.Password),
+		PasswordHash: passwordHash,
 		Email:        u.Email,
+		Role:         models.RoleUser,
 	}
 
 	err := user.Save()
 	if err != nil {
-		return UserResponse{}, api_errors.NewError(http.StatusInternalServerError).Add("body", err.Error())
+		return UserResponse{}, saveUserError(err, "body")
 	}
+	auditClient(AuditSignUp, client, &user, user.Email, OutcomeSuccess, "")
 
-	tokenString := auth.GetTokenString(u.Email)
-	return UserResponse{
-		Username: u.Username,
-		Email:    u.Email,
-		Bio:      "",
-		Image:    nil,
-		Token:    tokenString,
-	}, nil
+	mailErr := sendVerificationEmail(&user)
+	if mailErr != nil {
+		// user can ask for another verification mail later
+		log.Printf("could not send verification mail: %s", mailErr)
+	}
+
+	tokenString, refreshToken, tokenErr := issueTokens(&user, client)
+	if tokenErr != nil {
+		return UserResponse{}, tokenErr
+	}
+	return userToResponse(&user, tokenString, refreshToken), nil
 }
 
-func SignIn(u UserSignIn) (UserResponse, *api_errors.E) {
+func SignIn(u UserSignIn, client Client) (UserResponse, *api_errors.E) {
+	throttleErr := checkLoginThrottle(u.Email, client)
+	if throttleErr != nil {
+		auditClient(AuditSignIn, client, nil, u.Email, OutcomeFailure, "too many failed attempts")
+		return UserResponse{}, throttleErr
+	}
+
 	user, err := models.GetUser(u.Email)
 
 	if err != nil || auth.CheckPassword(u.Password, user.PasswordHash) != nil {
+		recordLoginFailure(u.Email, user, client)
+		auditClient(AuditSignIn, client, user, u.Email, OutcomeFailure, "wrong email or password")
 		return UserResponse{},
 			api_errors.NewError(http.StatusUnauthorized).Add("body", "email and password do not match")
 	}
+	upgradePasswordHash(user, u.Password)
 
-	tokenString := auth.GetTokenString(user.Email)
+	if user.TOTPEnabled {
+		// failures are cleared only after the second factor, or the password would reset the count of bad codes
+		auditClient(AuditSignIn, client, user, user.Email, OutcomePending, "second factor required")
+		return twoFactorChallenge(user), nil
+	}
+	clearLoginFailures(u.Email)
 
-	return UserResponse{
-		Username: user.Username,
-		Email:    user.Email,
-		Bio:      user.Bio,
-		Image:    user.Image,
-		Token:    tokenString,
-	}, nil
-}
+	tokenString, refreshToken, tokenErr := issueTokens(user, client)
+	if tokenErr != nil {
+		return UserResponse{}, tokenErr
+	}
+	auditClient(AuditSignIn, client, user, user.Email, OutcomeSuccess, "password")
 
-func GetUser(token string) (UserResponse, *api_errors.E) {
-	email, emailErr := auth.GetEmailFromTokenString(token)
-	if emailErr != nil {
-		return UserResponse{}, api_errors.NewError(http.StatusUnauthorized).Add("token", "token is invalid")
+	return userToResponse(user, tokenString, refreshToken), nil
+}
 
-	}
-	user, err := models.GetUser(email)
+func GetUser(actor *Actor) (UserResponse, *api_errors.E) {
+	user, err := actor.user(ScopeRead)
 	if err != nil {
-		return UserResponse{}, api_errors.NewError(http.StatusNotFound).Add("email", fmt.Sprintf("user not found"))
+		return UserResponse{}, err
 	}
-	return UserResponse{
-		Username: user.Username,
-		Email:    user.Email,
-		Bio:      user.Bio,
-		Image:    user.Image,
-		Token:    token,
-	}, nil
+	return userToResponse(user, actor.Token, ""), nil
 }
 
-func UpdateUser(userUpdate UserUpdate, token string) (*UserResponse, *api_errors.E) {
-	email, emailErr := auth.GetEmailFromTokenString(token)
-	if emailErr != nil {
-		return nil, api_errors.NewError(http.StatusUnauthorized).Add("token", "token is invalid")
-	}
-	user, userErr := models.GetUser(email)
+func UpdateUser(userUpdate UserUpdate, actor *Actor) (*UserResponse, *api_errors.E) {
+	user, userErr := actor.user(ScopeSession)
 	if userErr != nil {
-		return nil, api_errors.NewError(http.StatusNotFound).Add("email", fmt.Sprintf("could not find user with email %s", *userUpdate.Email))
+		return nil, userErr
 	}
-	if userUpdate.Email != nil {
+	emailChanged := false
+	oldEmail := user.Email
+	if userUpdate.Email != nil && *userUpdate.Email != user.Email {
+		validationErr := api_errors.NewValidationError()
+		validateEmail(*userUpdate.Email, validationErr)
+		if validationErr.HasErrors() {
+			return nil, validationErr
+		}
 		user.Email = *userUpdate.Email
+		user.EmailVerified = false
+		emailChanged = true
 	}
-	if userUpdate.Username != nil {
+	if userUpdate.Username != nil && *userUpdate.Username != user.Username {
+		validationErr := api_errors.NewValidationError()
+		validateUsername(*userUpdate.Username, user.ID, validationErr)
+		if validationErr.HasErrors() {
+			return nil, validationErr
+		}
 		user.Username = *userUpdate.Username
 	}
 	if userUpdate.Bio != nil {
@@ -124,40 +196,65 @@ func UpdateUser(userUpdate UserUpdate, token string) (*UserResponse, *api_errors
 		user.Image = userUpdate.Image
 	}
 	if userUpdate.Password != nil {
-		user.PasswordHash = auth.PasswordToHash(*userUpdate.Password)
+		validationErr := api_errors.NewValidationError()
+		validatePassword(*userUpdate.Password, user.Email, user.Username, validationErr)
+		if validationErr.HasErrors() {
+			return nil, validationErr
+		}
+		passwordHash, hashErr := hashPassword(*userUpdate.Password)
+		if hashErr != nil {
+			return nil, hashErr
+		}
+		user.PasswordHash = passwordHash
 	}
 	saveErr := user.Save()
 	if saveErr != nil {
-		return nil, api_errors.NewError(http.StatusInternalServerError).Add("user", saveErr.Error())
+		return nil, saveUserError(saveErr, "user")
+	}
+	if userUpdate.Private != nil && *userUpdate.Private != user.Private {
+		privateErr := models.SetUserPrivate(user.ID, *userUpdate.Private)
+		if privateErr != nil {
+			return nil, api_errors.NewError(http.StatusInternalServerError).Add("private", "could not change privacy")
+		}
+		user.Private = *userUpdate.Private
 	}
 
-	tokenString := auth.GetTokenString(user.Email)
-	return &UserResponse{
-		Username: user.Username,
-		Email:    user.Email,
-		Bio:      user.Bio,
-		Image:    user.Image,
-		Token:    tokenString,
-	}, nil
+	if userUpdate.Password != nil {
+		auditActor(AuditPasswordChange, actor, user, "")
+	}
+	if emailChanged {
+		auditActor(AuditEmailChange, actor, user, "changed from "+oldEmail)
+		mailErr := sendVerificationEmail(user)
+		if mailErr != nil {
+			log.Printf("could not send verification mail: %s", mailErr)
+		}
+	}
+
+	// the new token stays in the same refresh token family, so logout still revokes it
+	tokenString := auth.GetTokenString(user.ID, user.Email, actor.session(), user.Role)
+	response := userToResponse(user, tokenString, "")
+	return &response, nil
 }
 
-// If request is not authenticated with token, pass empty string as token and profile's follow will be false
-func GetProfile(username string, token string) (*Profile, *api_errors.E) {
+// If request is anonymous, pass nil actor and profile's follow will be false
+func GetProfile(username string, actor *Actor) (*Profile, *api_errors.E) {
+	profile, _, err := loadProfile(username, actor)
+	return profile, err
+}
+
+// Profile of username as actor sees it, with the loaded user for callers that need more of it
+func loadProfile(username string, actor *Actor) (*Profile, *models.User, *api_errors.E) {
 	user, userErr := models.GetUserByUsername(username)
 
 	if userErr != nil {
-		return nil, api_errors.NewError(404).Add("username", fmt.Sprintf("could not find user with this username: %s", username))
+		return nil, nil, api_errors.NewError(404).Add("username", fmt.Sprintf("could not find user with this username: %s", username))
 	}
 
 	following := false
-	if token != "" {
-		email, emailErr := auth.GetEmailFromTokenString(token)
-		if emailErr == nil {
-			follower, followerErr := models.GetUser(email)
-			if followerErr == nil {
-				following = models.IsFollowing(follower.ID, user.ID)
-			}
-		}
+	requested := false
+	if follower := viewer(actor); follower != nil {
+		following = models.IsFollowing(follower.ID, user.ID)
+		requested = !following && user.Private && models.IsFollowRequested(follower.ID, user.ID)
 	}
 
 	return &Profile{
@@ -165,24 +262,45 @@ func GetProfile(username string, token string) (*Profile, *api_errors.E) {
 		Bio:       user.Bio,
 		Image:     user.Image,
 		Following: following,
-	}, nil
+		Requested: requested,
+	}, user, nil
 }
 
-func FollowUser(username string, token string) (*Profile, *api_errors.E) {
+// Profile with counts of articles, favorites they received, followers and following
+func GetProfileWithStats(username string, actor *Actor) (*Profile, *api_errors.E) {
+	profile, user, err := loadProfile(username, actor)
+	if err != nil {
+		return nil, err
+	}
+	stats, statsErr := models.GetProfileStats(user.ID)
+	if statsErr != nil {
+		return nil, api_errors.NewError(http.StatusInternalServerError).Add("profile", "could not get profile stats")
+	}
+	profile.Stats = &ProfileStats{
+		ArticlesCount:  stats.ArticlesCount,
+		FavoritesCount: stats.FavoritesCount,
+		FollowersCount: stats.FollowersCount,
+		FollowingCount: stats.FollowingCount,
+	}
+	if user.CreatedAt != nil {
+		profile.Stats.MemberSince = formatTime(*user.CreatedAt)
+	}
+	return profile, nil
+}
+
+func FollowUser(username string, actor *Actor) (*Profile, *api_errors.E) {
 	user, userErr := models.GetUserByUsername(username)
 
 	if userErr != nil {
 		return nil, api_errors.NewError(404).Add("username", fmt.Sprintf("could not find user with this username: %s", username))
 	}
 
-	email, emailErr := auth.GetEmailFromTokenString(token)
-	if emailErr != nil {
-		return nil, api_errors.NewError(401).Add("email", fmt.Sprintf("token invalid"))
-	}
-
-	follower, followerErr := models.GetUser(email)
+	follower, followerErr := actor.user(ScopeProfilesWrite)
 	if followerErr != nil {
-		return nil, api_errors.NewError(404).Add("email", fmt.Sprintf("user not found"))
+		return nil, followerErr
+	}
+	if models.IsBlocked(user.ID, follower.ID) {
+		return nil, api_errors.NewError(http.StatusForbidden).Add("username", "you can not follow this user")
 	}
 
 	profile := Profile{
@@ -198,30 +316,39 @@ func FollowUser(username string, token string) (*Profile, *api_errors.E) {
 		return &profile, nil
 	}
 
+	if user.Private && user.ID != follower.ID {
+		requestErr := models.CreateFollowRequest(follower.ID, user.ID)
+		if requestErr != nil {
+			return nil, api_errors.NewError(http.StatusInternalServerError).Add("body", "could not request to follow user")
+		}
+		auditActor(AuditFollow, actor, follower, "requested to follow "+user.Username)
+		notify(user.ID, models.NotificationFollowRequest, nil, follower.ID)
+		profile.Following = false
+		profile.Requested = true
+		return &profile, nil
+	}
+
 	err := models.AddFollow(follower.ID, user.ID)
 
 	if err == nil {
+		auditActor(AuditFollow, actor, follower, "followed "+user.Username)
+		notify(user.ID, models.NotificationFollow, nil, follower.ID)
 		return &profile, nil
 	}
 
 	return nil, api_errors.NewError(http.StatusInternalServerError).Add("body", "could not follow user")
 }
 
-func UnfollowUser(username string, token string) (*Profile, *api_errors.E) {
+func UnfollowUser(username string, actor *Actor) (*Profile, *api_errors.E) {
 	user, userErr := models.GetUserByUsername(username)
 
 	if userErr != nil {
 		return nil, api_errors.NewError(404).Add("username", fmt.Sprintf("could not find user with this username: %s", username))
 	}
 
-	email, emailErr := auth.GetEmailFromTokenString(token)
-	if emailErr != nil {
-		return nil, api_errors.NewError(401).Add("email", fmt.Sprintf("token invalid"))
-	}
-
-	follower, followerErr := models.GetUser(email)
+	follower, followerErr := actor.user(ScopeProfilesWrite)
 	if followerErr != nil {
-		return nil, api_errors.NewError(404).Add("email", fmt.Sprintf("user not found"))
+		return nil, followerErr
 	}
 
 	profile := Profile{
@@ -234,14 +361,90 @@ func UnfollowUser(username string, token string) (*Profile, *api_errors.E) {
 	following := models.IsFollowing(follower.ID, user.ID)
 
 	if !following {
+		// withdraws a pending request to a private account
+		_, requestErr := models.DeleteFollowRequest(follower.ID, user.ID)
+		if requestErr != nil {
+			return nil, api_errors.NewError(http.StatusInternalServerError).Add("body", "could not withdraw follow request")
+		}
 		return &profile, nil
 	}
 
 	err := models.RemoveFollow(follower.ID, user.ID)
 
 	if err == nil {
+		auditActor(AuditUnfollow, actor, follower, "unfollowed "+user.Username)
 		return &profile, nil
 	}
 
 	return nil, api_errors.NewError(http.StatusInternalServerError).Add("body", "could not follow user")
 }
+
+// Users following username, pass nil actor for anonymous requests
+func ListFollowers(username string, limit uint, offset uint, actor *Actor) (*[]Profile, uint, *api_errors.E) {
+	return listFollows(models.ListFollowers, username, limit, offset, actor)
+}
+
+// Users username follows, pass nil actor for anonymous requests
+func ListFollowing(username string, limit uint, offset uint, actor *Actor) (*[]Profile, uint, *api_errors.E) {
+	return listFollows(models.ListFollowing, username, limit, offset, actor)
+}
+
+type followsQuery func(userID uint, viewerID uint, limit uint, offset uint) (*[]models.FollowProfile, uint, error)
+
+func listFollows(query followsQuery, username string, limit uint, offset uint, actor *Actor) (*[]Profile, uint, *api_errors.E) {
+	user, userErr := models.GetUserByUsername(username)
+	if userErr != nil {
+		return nil, 0, api_errors.NewError(http.StatusNotFound).Add("username", fmt.Sprintf("could not find user with this username: %s", username))
+	}
+	if limit == 0 {
+		limit = 20
+	}
+	var viewerID uint = 0
+	if v := viewer(actor); v != nil {
+		viewerID = v.ID
+	}
+	rows, count, err := query(user.ID, viewerID, limit, offset)
+	if err != nil {
+		return nil, 0, api_errors.NewError(http.StatusInternalServerError).Add("profiles", "could not get profiles")
+	}
+	return followProfilesToResponse(rows), count, nil
+}
+
+type ProfileSearch struct {
+	Query string
+	// models.SortRelevance, the default, or models.SortFollowers
+	Sort   string
+	Limit  uint
+	Offset uint
+}
+
+// Profiles matching the search in username or bio, pass nil actor for anonymous requests
+func SearchProfiles(s ProfileSearch, actor *Actor) (*[]Profile, uint, *api_errors.E) {
+	if s.Sort == "" {
+		s.Sort = models.SortRelevance
+	}
+	if s.Sort != models.SortRelevance && s.Sort != models.SortFollowers {
+		return nil, 0, api_errors.NewValidationError().Add("sort", "must be relevance or followers")
+	}
+	if s.Limit == 0 {
+		s.Limit = 20
+	}
+	var viewerID uint = 0
+	if v := viewer(actor); v != nil {
+		viewerID = v.ID
+	}
+	rows, count, err := models.SearchProfiles(s.Query, s.Sort, viewerID, s.Limit, s.Offset)
+	if err != nil {
+		return nil, 0, api_errors.NewError(http.StatusInternalServerError).Add("profiles", "could not search profiles")
+	}
+	result := []Profile{}
+	for _, row := range *rows {
+		result = append(result, Profile{
+			Username:  row.Username,
+			Bio:       row.Bio,
+			Image:     row.Image,
+			Following: row.Following,
+		})
+	}
+	return &result, count, nil
+}
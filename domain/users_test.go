@@ -1,15 +1,19 @@
 package domain_test
 
 import (
+	"../DB"
 	"../auth"
 	"../domain"
+	"../models"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCreateUser(t *testing.T) {
 	initDb()
 	defer closeDb()
-	r, err := domain.CreateUser(userCreate)
+	r, err := domain.CreateUser(userCreate, testClient)
 	defer destroyUser()
 	if err != nil {
 		t.Fatalf("could not create user: %s", err)
@@ -25,7 +29,7 @@ func TestSignIn(t *testing.T) {
 	createUser(t)
 	defer destroyUser()
 
-	result, err := domain.SignIn(userSignIn)
+	result, err := domain.SignIn(userSignIn, testClient)
 	if err != nil {
 		t.Fatalf("could not sign in, %s", err.Error())
 	}
@@ -46,7 +50,7 @@ func TestSignedInUserHasValidToken(t *testing.T) {
 	createUser(t)
 	defer destroyUser()
 
-	userResponse, err := domain.SignIn(userSignIn)
+	userResponse, err := domain.SignIn(userSignIn, testClient)
 	if err != nil {
 		t.Fatalf("could not sign in: %s", err.Error())
 	}
@@ -61,7 +65,7 @@ func TestTokenHasEmail(t *testing.T) {
 	defer closeDb()
 	createUser(t)
 	defer destroyUser()
-	userResponse, _ := domain.SignIn(userSignIn)
+	userResponse, _ := domain.SignIn(userSignIn, testClient)
 	tokenString := userResponse.Token
 	email, err := auth.GetEmailFromTokenString(tokenString)
 	if err != nil {
@@ -80,9 +84,9 @@ func TestGetUser(t *testing.T) {
 	defer closeDb()
 	createUser(t)
 	defer destroyUser()
-	userResponse, _ := domain.SignIn(userSignIn)
+	userResponse, _ := domain.SignIn(userSignIn, testClient)
 	tokenString := userResponse.Token
-	userResponse, err := domain.GetUser(tokenString)
+	userResponse, err := domain.GetUser(identify(tokenString))
 	if err != nil {
 		t.Fatalf("could not get user: %s", err.Error())
 	}
@@ -99,7 +103,7 @@ func TestUpdateUser(t *testing.T) {
 	defer closeDb()
 	createUser(t)
 	defer destroyUser()
-	si, _ := domain.SignIn(userSignIn)
+	si, _ := domain.SignIn(userSignIn, testClient)
 	tokenString := si.Token
 
 	userName := "asdasd"
@@ -107,7 +111,7 @@ func TestUpdateUser(t *testing.T) {
 		Username: &userName,
 	}
 
-	userResponse, err := domain.UpdateUser(userUpdate, tokenString)
+	userResponse, err := domain.UpdateUser(userUpdate, identify(tokenString))
 	if err != nil {
 		t.Fatalf("could not update user: %s", err.Error())
 	}
@@ -129,9 +133,9 @@ func TestGetProfile(t *testing.T) {
 	defer closeDb()
 	createUser(t)
 	defer destroyUser()
-	userResponse, _ := domain.SignIn(userSignIn)
+	userResponse, _ := domain.SignIn(userSignIn, testClient)
 	tokenString := userResponse.Token
-	profile, err := domain.GetProfile(userCreate.Username, tokenString)
+	profile, err := domain.GetProfile(userCreate.Username, identify(tokenString))
 	if err != nil {
 		t.Fatalf("could not get profile: %s", err.Error())
 	}
@@ -148,9 +152,9 @@ func TestFollowUser(t *testing.T) {
 	defer closeDb()
 	createUser(t)
 	defer destroyUser()
-	userResponse, _ := domain.SignIn(userSignIn)
+	userResponse, _ := domain.SignIn(userSignIn, testClient)
 	tokenString := userResponse.Token
-	profile, err := domain.FollowUser(userCreate.Username, tokenString)
+	profile, err := domain.FollowUser(userCreate.Username, identify(tokenString))
 	if err != nil {
 		t.Fatalf("could not follow user: %s", err.Error())
 	}
@@ -164,9 +168,9 @@ func TestUnfollowUser(t *testing.T) {
 	defer closeDb()
 	createUser(t)
 	defer destroyUser()
-	userResponse, _ := domain.SignIn(userSignIn)
+	userResponse, _ := domain.SignIn(userSignIn, testClient)
 	tokenString := userResponse.Token
-	profile, err := domain.UnfollowUser(userCreate.Username, tokenString)
+	profile, err := domain.UnfollowUser(userCreate.Username, identify(tokenString))
 	if err != nil {
 		t.Fatalf("could not unfollow user: %s", err.Error())
 	}
@@ -174,3 +178,265 @@ func TestUnfollowUser(t *testing.T) {
 		t.Fatalf("profile should not be following after follow")
 	}
 }
+
+func TestRefreshToken(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createUser(t)
+	defer destroyUser()
+	si, _ := domain.SignIn(userSignIn, testClient)
+	if si.RefreshToken == "" {
+		t.Fatalf("sign in response has no refresh token")
+	}
+
+	refreshed, err := domain.RefreshToken(domain.TokenRefresh{RefreshToken: si.RefreshToken})
+	if err != nil {
+		t.Fatalf("could not refresh token: %s", err.Error())
+	}
+	if refreshed.RefreshToken == "" || refreshed.RefreshToken == si.RefreshToken {
+		t.Fatalf("refresh token was not rotated")
+	}
+	if domain.CheckToken(refreshed.Token, domain.ScopeRead) != nil {
+		t.Fatalf("refreshed token is invalid")
+	}
+
+	_, reuseErr := domain.RefreshToken(domain.TokenRefresh{RefreshToken: si.RefreshToken})
+	if reuseErr == nil {
+		t.Fatalf("used refresh token was accepted again")
+	}
+	if domain.CheckToken(refreshed.Token, domain.ScopeRead) == nil {
+		t.Fatalf("token is still valid after its refresh token family was revoked")
+	}
+}
+
+func TestLogout(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createUser(t)
+	defer destroyUser()
+	si, _ := domain.SignIn(userSignIn, testClient)
+
+	err := domain.Logout(identify(si.Token))
+	if err != nil {
+		t.Fatalf("could not log out: %s", err.Error())
+	}
+	if domain.CheckToken(si.Token, domain.ScopeRead) == nil {
+		t.Fatalf("token is still valid after logout")
+	}
+	_, refreshErr := domain.RefreshToken(domain.TokenRefresh{RefreshToken: si.RefreshToken})
+	if refreshErr == nil {
+		t.Fatalf("refresh token is still valid after logout")
+	}
+}
+
+func TestSignInUpgradesPasswordHash(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createUser(t)
+	defer destroyUser()
+	legacy, _ := auth.DefaultBcrypt.Hash(userCreate.Password)
+	DB.Get().Model(&models.User{}).Where(&models.User{Email: userCreate.Email}).UpdateColumn("password", legacy)
+
+	_, err := domain.SignIn(userSignIn, testClient)
+	if err != nil {
+		t.Fatalf("could not sign in with legacy hash: %s", err)
+	}
+	user, _ := models.GetUser(userCreate.Email)
+	if auth.PasswordNeedsRehash(user.PasswordHash) {
+		t.Fatalf("password hash was not upgraded: %s", user.PasswordHash)
+	}
+	_, signInErr := domain.SignIn(userSignIn, testClient)
+	if signInErr != nil {
+		t.Fatalf("could not sign in with upgraded hash: %s", signInErr)
+	}
+}
+
+func TestCreateUserPasswordPolicy(t *testing.T) {
+	initDb()
+	defer closeDb()
+	defer destroyUser()
+
+	for _, password := range []string{"", "short", "password", userCreate.Username} {
+		weak := userCreate
+		weak.Password = password
+		_, err := domain.CreateUser(weak, testClient)
+		if err == nil {
+			t.Fatalf("user was created with password %q", password)
+		}
+	}
+}
+
+func TestTokenFollowsUserAfterEmailChange(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createUser(t)
+	defer destroyUser()
+	si, _ := domain.SignIn(userSignIn, testClient)
+
+	newEmail := "u23@u"
+	defer DB.Get().Exec("DELETE FROM users WHERE email = 'u23@u'")
+	_, err := domain.UpdateUser(domain.UserUpdate{Email: &newEmail}, identify(si.Token))
+	if err != nil {
+		t.Fatalf("could not update email: %s", err)
+	}
+	// somebody else registers with the old email
+	_, createErr := domain.CreateUser(domain.UserCreate{Email: userCreate.Email, Username: "other54tersdfg", Password: userCreate.Password}, testClient)
+	if createErr != nil {
+		t.Fatalf("could not create user with old email: %s", createErr)
+	}
+
+	user, userErr := domain.GetUser(identify(si.Token))
+	if userErr != nil {
+		t.Fatalf("token stopped working after email change: %s", userErr)
+	}
+	if user.Email != newEmail || user.Username != userCreate.Username {
+		t.Fatalf("token resolved to another user: %s %s", user.Email, user.Username)
+	}
+}
+
+func TestEmailTokensAcceptedUntilCutoff(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createUser(t)
+	defer destroyUser()
+	defer domain.SetEmailTokensAcceptedUntil(time.Time{})
+	// tokens signed before the user id became the subject only had the email
+	legacy := auth.GetPurposeTokenString("", "", userCreate.Email, time.Hour)
+
+	domain.SetEmailTokensAcceptedUntil(time.Now().Add(time.Hour))
+	actor, err := domain.Authenticate(legacy, testClient)
+	if err != nil {
+		t.Fatalf("email token was refused before the cutoff: %s", err)
+	}
+	if actor.User.Email != userCreate.Email {
+		t.Fatalf("email token resolved to another user: %s", actor.User.Email)
+	}
+
+	domain.SetEmailTokensAcceptedUntil(time.Now().Add(-time.Minute))
+	_, err = domain.Authenticate(legacy, testClient)
+	if err == nil {
+		t.Fatalf("email token was accepted after the cutoff")
+	}
+}
+
+func TestUsernameIsUniqueIgnoringCase(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createUser(t)
+	defer destroyUser()
+
+	other := domain.UserCreate{Email: "u24@u", Username: strings.ToUpper(userCreate.Username), Password: userCreate.Password}
+	defer DB.Get().Exec("DELETE FROM users WHERE email = 'u24@u'")
+	_, err := domain.CreateUser(other, testClient)
+	if err == nil {
+		t.Fatalf("created user with a taken username in other case")
+	}
+	for _, username := range []string{"Admin", "a b", "x"} {
+		other.Username = username
+		_, err = domain.CreateUser(other, testClient)
+		if err == nil {
+			t.Fatalf("created user with invalid username %s", username)
+		}
+	}
+
+	profile, profileErr := domain.GetProfile(strings.ToUpper(userCreate.Username), nil)
+	if profileErr != nil {
+		t.Fatalf("could not get profile ignoring case: %s", profileErr)
+	}
+	if profile.Username != userCreate.Username {
+		t.Fatalf("got profile of %s", profile.Username)
+	}
+}
+
+func TestListFollowersAndFollowing(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createUser(t)
+	defer destroyUser()
+	other, _ := domain.CreateUser(moderatorCreate, testClient)
+	defer destroyModerator()
+	user, _ := domain.SignIn(userSignIn, testClient)
+	domain.FollowUser(userCreate.Username, identify(other.Token))
+
+	followers, count, err := domain.ListFollowers(userCreate.Username, 0, 0, identify(user.Token))
+	if err != nil {
+		t.Fatalf("could not list followers: %s", err)
+	}
+	if count != 1 || len(*followers) != 1 || (*followers)[0].Username != moderatorCreate.Username {
+		t.Fatalf("unexpected followers: %v", *followers)
+	}
+	if (*followers)[0].Following {
+		t.Fatalf("viewer does not follow the follower yet")
+	}
+
+	domain.FollowUser(moderatorCreate.Username, identify(user.Token))
+	followers, _, _ = domain.ListFollowers(userCreate.Username, 0, 0, identify(user.Token))
+	if !(*followers)[0].Following {
+		t.Fatalf("viewer follows the follower")
+	}
+	following, count, err := domain.ListFollowing(moderatorCreate.Username, 0, 0, nil)
+	if err != nil {
+		t.Fatalf("could not list following: %s", err)
+	}
+	if count != 1 || (*following)[0].Username != userCreate.Username || (*following)[0].Following {
+		t.Fatalf("unexpected following for anonymous viewer: %v", *following)
+	}
+}
+
+func TestGetProfileWithStats(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createArticle(t)
+	defer destroyArticle()
+	other, _ := domain.CreateUser(moderatorCreate, testClient)
+	defer destroyModerator()
+	domain.FollowUser(userCreate.Username, identify(other.Token))
+	domain.FavoriteArticle(domain.SlugFromTitle(articleCreate.Title), identify(other.Token))
+	defer DB.Get().Exec("DELETE FROM favorites WHERE user_id IN (SELECT id FROM users WHERE email = 'm22@m')")
+
+	profile, err := domain.GetProfileWithStats(userCreate.Username, nil)
+	if err != nil {
+		t.Fatalf("could not get profile with stats: %s", err)
+	}
+	stats := profile.Stats
+	if stats.ArticlesCount != 1 || stats.FavoritesCount != 1 || stats.FollowersCount != 1 || stats.FollowingCount != 0 {
+		t.Fatalf("unexpected stats: %+v", *stats)
+	}
+	if stats.MemberSince == "" {
+		t.Fatalf("new user has no member since date")
+	}
+	plain, _ := domain.GetProfile(userCreate.Username, nil)
+	if plain.Stats != nil {
+		t.Fatalf("stats are included without asking")
+	}
+}
+
+func TestSearchProfiles(t *testing.T) {
+	initDb()
+	defer closeDb()
+	createUser(t)
+	defer destroyUser()
+	other, _ := domain.CreateUser(moderatorCreate, testClient)
+	defer destroyModerator()
+	domain.FollowUser(userCreate.Username, identify(other.Token))
+
+	profiles, count, err := domain.SearchProfiles(domain.ProfileSearch{Query: userCreate.Username[:6]}, identify(other.Token))
+	if err != nil {
+		t.Fatalf("could not search profiles: %s", err)
+	}
+	if count == 0 || (*profiles)[0].Username != userCreate.Username {
+		t.Fatalf("prefix match is not first: %v", *profiles)
+	}
+	if !(*profiles)[0].Following {
+		t.Fatalf("viewer follows the found profile")
+	}
+
+	_, _, err = domain.SearchProfiles(domain.ProfileSearch{Query: "x", Sort: "newest"}, nil)
+	if err == nil {
+		t.Fatalf("search accepted unknown sort")
+	}
+	_, _, err = domain.SearchProfiles(domain.ProfileSearch{Query: "%_", Sort: "followers"}, nil)
+	if err != nil {
+		t.Fatalf("could not search with like wildcards: %s", err)
+	}
+}
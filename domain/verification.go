@@ -0,0 +1,94 @@
+package domain
+
+import (
+	"../api_errors"
+	"../auth"
+	"../mail"
+	"../models"
+	"../utils"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const emailVerificationTTL = time.Hour * 48
+
+// Actions that can be restricted to users with verified email
+const (
+	RestrictArticles = "articles"
+	RestrictComments = "comments"
+)
+
+var verifiedEmailRequired = map[string]bool{}
+
+func SetVerifiedEmailRequired(actions []string) {
+	result := map[string]bool{}
+	for _, a := range actions {
+		result[a] = true
+	}
+	verifiedEmailRequired = result
+}
+
+type EmailVerify struct {
+	Token string `json:"token"`
+}
+
+func requireVerifiedEmail(user *models.User, action string) *api_errors.E {
+	if !verifiedEmailRequired[action] || user.EmailVerified {
+		return nil
+	}
+	return api_errors.NewError(http.StatusForbidden).Add("email", fmt.Sprintf("should be verified to post %s", action))
+}
+
+// Mails a signed link for the current email of the user, the link stops working if email changes
+func sendVerificationEmail(user *models.User) error {
+	token := auth.GetPurposeTokenString(auth.PurposeVerifyEmail, strconv.Itoa(int(user.ID)), user.Email, emailVerificationTTL)
+	link := fmt.Sprintf("%s/verify-email?token=%s", utils.AppURL(), url.QueryEscape(token))
+	return mail.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email for Conduit",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nplease confirm that this is your email by following this link within %s:\n%s",
+			user.Username, emailVerificationTTL, link,
+		),
+	})
+}
+
+func VerifyEmail(v EmailVerify) *api_errors.E {
+	invalid := api_errors.NewError(http.StatusUnauthorized).Add("token", "verification token is invalid or expired")
+	claims, err := auth.GetPurposeClaims(v.Token, auth.PurposeVerifyEmail)
+	if err != nil {
+		return invalid
+	}
+	userID, idErr := strconv.Atoi(claims.Subject)
+	if idErr != nil {
+		return invalid
+	}
+	verified, verifyErr := models.SetEmailVerified(uint(userID), claims.Email)
+	if verifyErr != nil {
+		return api_errors.NewError(http.StatusInternalServerError).Add("email", "could not verify email")
+	}
+	if !verified {
+		return invalid
+	}
+	id := uint(userID)
+	audit(models.AuditEvent{Type: AuditEmailVerify, UserID: &id, ActorID: &id, Email: claims.Email, Outcome: OutcomeSuccess})
+	return nil
+}
+
+func ResendVerificationEmail(actor *Actor) *api_errors.E {
+	user, userErr := actor.user(ScopeSession)
+	if userErr != nil {
+		return userErr
+	}
+	if user.EmailVerified {
+		return api_errors.NewError(http.StatusUnprocessableEntity).Add("email", "is already verified")
+	}
+	err := sendVerificationEmail(user)
+	if err != nil {
+		return api_errors.NewError(http.StatusInternalServerError).Add("email", "could not send verification mail")
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package domain_test
+
+import (
+	"../domain"
+	"../mail"
+	"testing"
+)
+
+func TestVerifyEmail(t *testing.T) {
+	initDb()
+	defer closeDb()
+	mailer := &recordingMailer{}
+	mail.SetMailer(mailer)
+	defer mail.SetMailer(mail.NewLocalMailer(""))
+	createUser(t)
+	defer destroyUser()
+
+	if len(mailer.sent) != 1 {
+		t.Fatalf("verification mail was not sent on registration")
+	}
+	match := linkTokenRe.FindStringSubmatch(mailer.sent[0].Body)
+	if match == nil {
+		t.Fatalf("verification mail has no token: %s", mailer.sent[0].Body)
+	}
+	si, _ := domain.SignIn(userSignIn, testClient)
+	if si.EmailVerified {
+		t.Fatalf("email is verified before following the link")
+	}
+
+	err := domain.VerifyEmail(domain.EmailVerify{Token: match[1]})
+	if err != nil {
+		t.Fatalf("could not verify email: %s", err)
+	}
+	user, _ := domain.GetUser(identify(si.Token))
+	if !user.EmailVerified {
+		t.Fatalf("email is not verified after following the link")
+	}
+}
+
+func TestUnverifiedUserCanNotPublish(t *testing.T) {
+	initDb()
+	defer closeDb()
+	domain.SetVerifiedEmailRequired([]string{domain.RestrictArticles})
+	defer domain.SetVerifiedEmailRequired(nil)
+	createUser(t)
+	defer destroyArticle()
+	si, _ := domain.SignIn(userSignIn, testClient)
+
+	_, err := domain.CreateArticle(articleCreate, identify(si.Token))
+	if err == nil {
+		t.Fatalf("unverified user published an article")
+	}
+}
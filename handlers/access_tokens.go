@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"../api_errors"
+	"../domain"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+func listAccessTokensHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	tokens, err := domain.ListAccessTokens(actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write(respToByte(*tokens, "tokens")))
+}
+
+func createAccessTokenHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	var create domain.AccessTokenCreate
+	readErr := readRequestField(r, "token", &create)
+	if readErr != nil {
+		readErr.Send(w)
+		return
+	}
+	result, err := domain.CreateAccessToken(create, actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write(respToByte(result, "token")))
+}
+
+func deleteAccessTokenHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	vars := mux.Vars(r)
+	id, parseErr := strconv.ParseUint(vars["id"], 10, 64)
+	if parseErr != nil {
+		api_errors.NewError(http.StatusNotFound).Add("token", "token not found").Send(w)
+		return
+	}
+	err := domain.DeleteAccessToken(uint(id), actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write([]byte{}))
+}
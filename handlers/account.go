@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"../domain"
+	"log"
+	"net/http"
+)
+
+func signInTwoFactorHandle(w http.ResponseWriter, r *http.Request) {
+	var signIn domain.TwoFactorSignIn
+	readErr := readRequestField(r, "user", &signIn)
+	if readErr != nil {
+		readErr.Send(w)
+		return
+	}
+	user, err := domain.SignInTwoFactor(signIn, clientFromRequest(r))
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write(respToByte(user, "user")))
+}
+
+func enrollTOTPHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	enrollment, err := domain.EnrollTOTP(actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write(respToByte(enrollment, "totp")))
+}
+
+func confirmTOTPHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	var code domain.TwoFactorCode
+	readErr := readRequestField(r, "totp", &code)
+	if readErr != nil {
+		readErr.Send(w)
+		return
+	}
+	codes, err := domain.ConfirmTOTP(code, actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write(respToByte(codes, "totp")))
+}
+
+func disableTOTPHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	var code domain.TwoFactorCode
+	readErr := readRequestField(r, "totp", &code)
+	if readErr != nil {
+		readErr.Send(w)
+		return
+	}
+	err := domain.DisableTOTP(code, actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write([]byte{}))
+}
+
+func unlockAccountHandle(w http.ResponseWriter, r *http.Request) {
+	var unlock domain.AccountUnlock
+	readErr := readRequestField(r, "user", &unlock)
+	if readErr != nil {
+		readErr.Send(w)
+		return
+	}
+	err := domain.UnlockAccount(unlock, clientFromRequest(r))
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write([]byte{}))
+}
@@ -34,13 +34,13 @@ func createArticleRead(r *http.Request) (*domain.ArticleCreate, *api_errors.E) {
 }
 
 func createArticleHandle(w http.ResponseWriter, r *http.Request) {
-	token, _ := GetTokenFromRequest(r)
+	actor := actorFromRequest(r)
 	data, readErr := createArticleRead(r)
 	if readErr != nil {
 		readErr.Send(w)
 		return
 	}
-	user, err := domain.CreateArticle(*data, token)
+	user, err := domain.CreateArticle(*data, actor)
 	if err != nil {
 		err.Send(w)
 		return
@@ -49,7 +49,7 @@ func createArticleHandle(w http.ResponseWriter, r *http.Request) {
 }
 
 func getArticleHandle(w http.ResponseWriter, r *http.Request) {
-	token, _ := GetTokenFromRequest(r)
+	actor := actorFromRequest(r)
 	vars := mux.Vars(r)
 	slug := vars["slug"]
 	if slug == "" {
@@ -57,7 +57,7 @@ func getArticleHandle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	article, err := domain.GetArticle(slug, token)
+	article, err := domain.GetArticle(slug, actor)
 	if err != nil {
 		err.Send(w)
 		return
@@ -66,14 +66,14 @@ func getArticleHandle(w http.ResponseWriter, r *http.Request) {
 }
 
 func favoriteArticleHandle(w http.ResponseWriter, r *http.Request) {
-	token, _ := GetTokenFromRequest(r)
+	actor := actorFromRequest(r)
 	vars := mux.Vars(r)
 	slug := vars["slug"]
 	if slug == "" {
 		api_errors.NewError(http.StatusBadRequest).Add("slug", "article request should contain slug").Send(w)
 		return
 	}
-	article, err := domain.FavoriteArticle(slug, token)
+	article, err := domain.FavoriteArticle(slug, actor)
 	if err != nil {
 		err.Send(w)
 		return
@@ -82,14 +82,14 @@ func favoriteArticleHandle(w http.ResponseWriter, r *http.Request) {
 }
 
 func unfavoriteArticleHandle(w http.ResponseWriter, r *http.Request) {
-	token, _ := GetTokenFromRequest(r)
+	actor := actorFromRequest(r)
 	vars := mux.Vars(r)
 	slug := vars["slug"]
 	if slug == "" {
 		api_errors.NewError(http.StatusBadRequest).Add("slug", "article request should contain slug").Send(w)
 		return
 	}
-	article, err := domain.UnfavoriteArticle(slug, token)
+	article, err := domain.UnfavoriteArticle(slug, actor)
 	if err != nil {
 		err.Send(w)
 		return
@@ -98,14 +98,14 @@ func unfavoriteArticleHandle(w http.ResponseWriter, r *http.Request) {
 }
 
 func deleteArticleHandle(w http.ResponseWriter, r *http.Request) {
-	token, _ := GetTokenFromRequest(r)
+	actor := actorFromRequest(r)
 	vars := mux.Vars(r)
 	slug := vars["slug"]
 	if slug == "" {
 		api_errors.NewError(http.StatusBadRequest).Add("slug", "article request should contain slug").Send(w)
 		return
 	}
-	err := domain.DeleteArticle(slug, token)
+	err := domain.DeleteArticle(slug, actor)
 	if err != nil {
 		err.Send(w)
 		return
@@ -136,7 +136,7 @@ func updateArticleRead(r *http.Request) (*map[string]interface{}, *api_errors.E)
 }
 
 func updateArticleHandle(w http.ResponseWriter, r *http.Request) {
-	token, _ := GetTokenFromRequest(r)
+	actor := actorFromRequest(r)
 	vars := mux.Vars(r)
 	slug := vars["slug"]
 	if slug == "" {
@@ -150,7 +150,7 @@ func updateArticleHandle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	article, err := domain.UpdateArticle(slug, *updateData, token)
+	article, err := domain.UpdateArticle(slug, *updateData, actor)
 	if err != nil {
 		err.Send(w)
 		return
@@ -159,7 +159,7 @@ func updateArticleHandle(w http.ResponseWriter, r *http.Request) {
 }
 
 func listArticlesHandle(w http.ResponseWriter, r *http.Request) {
-	token, _ := GetTokenFromRequest(r)
+	actor := actorFromRequest(r)
 	vars := mux.Vars(r)
 
 	var tag *string = nil
@@ -194,7 +194,7 @@ func listArticlesHandle(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	result, count, err := domain.ListArticles(tag, author, favorited, limit, offset, token)
+	result, count, err := domain.ListArticles(tag, author, favorited, limit, offset, actor)
 
 	if err != nil {
 		err.Send(w)
@@ -204,7 +204,7 @@ func listArticlesHandle(w http.ResponseWriter, r *http.Request) {
 }
 
 func feedArticlesHandle(w http.ResponseWriter, r *http.Request) {
-	token, _ := GetTokenFromRequest(r)
+	actor := actorFromRequest(r)
 	vars := mux.Vars(r)
 
 	var limit uint = 0
@@ -224,7 +224,7 @@ func feedArticlesHandle(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	result, count, err := domain.FeedArticles(limit, offset, token)
+	result, count, err := domain.FeedArticles(limit, offset, actor)
 
 	if err != nil {
 		err.Send(w)
@@ -243,7 +243,7 @@ func getAllTagsHandle(w http.ResponseWriter, r *http.Request) {
 }
 
 func createCommentHandle(w http.ResponseWriter, r *http.Request) {
-	token, _ := GetTokenFromRequest(r)
+	actor := actorFromRequest(r)
 	vars := mux.Vars(r)
 
 	slug, found := vars["slug"]
@@ -274,7 +274,7 @@ func createCommentHandle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := domain.CreateComment(body, slug, token)
+	result, err := domain.CreateComment(body, slug, actor)
 	if err != nil {
 		err.Send(w)
 		return
@@ -284,7 +284,7 @@ func createCommentHandle(w http.ResponseWriter, r *http.Request) {
 }
 
 func getCommentsHandle(w http.ResponseWriter, r *http.Request) {
-	token, _ := GetTokenFromRequest(r)
+	actor := actorFromRequest(r)
 	vars := mux.Vars(r)
 
 	slug, found := vars["slug"]
@@ -293,7 +293,7 @@ func getCommentsHandle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := domain.GetCommentsForArticle(slug, token)
+	result, err := domain.GetCommentsForArticle(slug, actor)
 	if err != nil {
 		err.Send(w)
 		return
@@ -303,7 +303,7 @@ func getCommentsHandle(w http.ResponseWriter, r *http.Request) {
 }
 
 func deleteCommentHandle(w http.ResponseWriter, r *http.Request) {
-	token, _ := GetTokenFromRequest(r)
+	actor := actorFromRequest(r)
 	vars := mux.Vars(r)
 
 	commentId, found := vars["commentId"]
@@ -318,7 +318,7 @@ func deleteCommentHandle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := domain.DeleteComment(uint(commentIdInt), token)
+	err := domain.DeleteComment(uint(commentIdInt), actor)
 	if err != nil {
 		err.Send(w)
 		return
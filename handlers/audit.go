@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"../api_errors"
+	"../domain"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const ndjsonContentType = "application/x-ndjson"
+
+func auditQueryFromRequest(r *http.Request) (domain.AuditQuery, *api_errors.E) {
+	values := r.URL.Query()
+	q := domain.AuditQuery{Username: values.Get("user")}
+	q.Type = values.Get("type")
+
+	validationErr := api_errors.NewValidationError()
+	for _, name := range []string{"from", "to"} {
+		value := values.Get(name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			validationErr.Add(name, "must be an RFC 3339 time")
+			continue
+		}
+		if name == "from" {
+			q.From = &t
+		} else {
+			q.To = &t
+		}
+	}
+	q.Limit, q.Offset = pageFromRequest(r)
+	if validationErr.HasErrors() {
+		return q, validationErr
+	}
+	return q, nil
+}
+
+func listAuditEventsHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	q, queryErr := auditQueryFromRequest(r)
+	if queryErr != nil {
+		queryErr.Send(w)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "ndjson" || strings.Contains(r.Header.Get("Accept"), ndjsonContentType) {
+		encoder := json.NewEncoder(w)
+		started := false
+		err := domain.ExportAuditEvents(q, actor, func(event domain.AuditEventResponse) error {
+			if !started {
+				w.Header().Set("Content-Type", ndjsonContentType)
+				started = true
+			}
+			return encoder.Encode(event)
+		})
+		if err != nil {
+			if started {
+				// the status is already sent, the client sees a truncated stream
+				log.Println(err)
+				return
+			}
+			err.Send(w)
+			return
+		}
+		if !started {
+			w.Header().Set("Content-Type", ndjsonContentType)
+			w.WriteHeader(http.StatusOK)
+		}
+		return
+	}
+
+	result, count, err := domain.ListAuditEvents(q, actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	newResponse().addField("events", *result).addField("eventsCount", count).send(w)
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"../api_errors"
+	"../domain"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+)
+
+type profileAction func(username string, actor *domain.Actor) (*domain.Profile, *api_errors.E)
+
+func profileActionHandle(action profileAction) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actor := actorFromRequest(r)
+		vars := mux.Vars(r)
+		profile, err := action(vars["username"], actor)
+		if err != nil {
+			err.Send(w)
+			return
+		}
+		log.Println(w.Write(respToByte(profile, "profile")))
+	}
+}
+
+var blockHandle = profileActionHandle(domain.BlockUser)
+var unblockHandle = profileActionHandle(domain.UnblockUser)
+var muteHandle = profileActionHandle(domain.MuteUser)
+var unmuteHandle = profileActionHandle(domain.UnmuteUser)
+
+func listBlocksHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	profiles, err := domain.ListBlocks(actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write(respToByte(*profiles, "profiles")))
+}
+
+func listMutesHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	profiles, err := domain.ListMutes(actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write(respToByte(*profiles, "profiles")))
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"../domain"
+	"fmt"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func requestDataExportHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	export, err := domain.RequestDataExport(actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	log.Println(w.Write(respToByte(export, "export")))
+}
+
+func getDataExportHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	export, err := domain.GetDataExport(actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write(respToByte(export, "export")))
+}
+
+func downloadDataExportHandle(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	export, archive, err := domain.DownloadDataExport(vars["token"])
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	if archive == nil {
+		// still being built, the link works once it is ready
+		w.Header().Set("Retry-After", "10")
+		w.WriteHeader(http.StatusAccepted)
+		log.Println(w.Write(respToByte(export, "export")))
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=\"conduit-export-%s.zip\"", time.Now().UTC().Format("2006-01-02")))
+	w.Header().Set("Cache-Control", "no-store")
+	log.Println(w.Write(archive))
+}
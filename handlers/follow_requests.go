@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"../domain"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+)
+
+var approveFollowRequestHandle = profileActionHandle(domain.ApproveFollowRequest)
+
+func listFollowRequestsHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	profiles, err := domain.ListFollowRequests(actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write(respToByte(*profiles, "profiles")))
+}
+
+func rejectFollowRequestHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	vars := mux.Vars(r)
+	err := domain.RejectFollowRequest(vars["username"], actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write([]byte{}))
+}
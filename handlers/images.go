@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"../api_errors"
+	"../domain"
+	"../storage"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Multipart form with the file in the "image" field
+func uploadAvatarHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	// room for the multipart headers around the file
+	r.Body = http.MaxBytesReader(w, r.Body, domain.MaxAvatarBytes+1<<16)
+	file, _, formErr := r.FormFile("image")
+	if formErr != nil {
+		api_errors.NewError(http.StatusBadRequest).Add("image", "request should be a multipart form with an image file").Send(w)
+		return
+	}
+	defer file.Close()
+	data, readErr := ioutil.ReadAll(file)
+	if readErr != nil {
+		api_errors.NewError(http.StatusBadRequest).Add("image", "could not read image").Send(w)
+		return
+	}
+	user, err := domain.UploadAvatar(data, actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write(respToByte(user, "user")))
+}
+
+// Only avatars are public, other stored files like data exports are downloaded with their own tokens
+func imageHandle(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var data []byte
+	err := storage.ErrNotFound
+	if strings.HasPrefix(vars["key"], "avatars/") {
+		data, err = storage.Get(vars["key"])
+	}
+	if err != nil {
+		api_errors.NewError(http.StatusNotFound).Add("image", "image not found").Send(w)
+		return
+	}
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	// a new upload gets a new key, so stored files never change
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	log.Println(w.Write(data))
+}
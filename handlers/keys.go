@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"../auth"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// Public signing keys, so that other services can verify tokens without the HMAC secret
+func jwksHandle(w http.ResponseWriter, r *http.Request) {
+	result, _ := json.Marshal(auth.PublicKeys())
+	w.Header().Set("Content-Type", "application/json")
+	log.Println(w.Write(result))
+}
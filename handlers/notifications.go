@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"../api_errors"
+	"../domain"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// Query parameters: unread=true, limit, offset
+func listNotificationsHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	limit, offset := pageFromRequest(r)
+	q := domain.NotificationQuery{Unread: r.URL.Query().Get("unread") == "true", Limit: limit, Offset: offset}
+	notifications, count, unread, err := domain.ListNotifications(q, actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	newResponse().
+		addField("notifications", *notifications).
+		addField("notificationsCount", count).
+		addField("unreadCount", unread).
+		send(w)
+}
+
+func markNotificationReadHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	vars := mux.Vars(r)
+	id, parseErr := strconv.ParseUint(vars["id"], 10, 64)
+	if parseErr != nil {
+		api_errors.NewError(http.StatusNotFound).Add("notification", "not found").Send(w)
+		return
+	}
+	err := domain.MarkNotificationRead(uint(id), actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write([]byte{}))
+}
+
+func markAllNotificationsReadHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	err := domain.MarkAllNotificationsRead(actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write([]byte{}))
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"../api_errors"
+	"../domain"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+)
+
+func listOIDCProvidersHandle(w http.ResponseWriter, r *http.Request) {
+	newResponse().addField("providers", domain.ListOIDCProviders()).send(w)
+}
+
+func startOIDCHandle(w http.ResponseWriter, r *http.Request) {
+	provider := mux.Vars(r)["provider"]
+	if provider == "" {
+		api_errors.NewError(http.StatusBadRequest).Add("provider", "request should contain provider").Send(w)
+		return
+	}
+	authorization, err := domain.StartOIDC(provider)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write(respToByte(authorization, "oidc")))
+}
+
+func finishOIDCHandle(w http.ResponseWriter, r *http.Request) {
+	provider := mux.Vars(r)["provider"]
+	if provider == "" {
+		api_errors.NewError(http.StatusBadRequest).Add("provider", "request should contain provider").Send(w)
+		return
+	}
+	var callback domain.OIDCCallback
+	readErr := readRequestField(r, "oidc", &callback)
+	if readErr != nil {
+		readErr.Send(w)
+		return
+	}
+	user, err := domain.FinishOIDC(provider, callback, clientFromRequest(r))
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write(respToByte(user, "user")))
+}
@@ -11,8 +11,36 @@ func UseRoutes(r *mux.Router) {
 	authRoutes.Use(AuthRequest)
 	authRoutes.HandleFunc("/user", getUserHandle).Methods(http.MethodGet)
 	authRoutes.HandleFunc("/user", updateUserHandle).Methods(http.MethodPut)
+	authRoutes.HandleFunc("/user", deleteUserHandle).Methods(http.MethodDelete)
+	authRoutes.HandleFunc("/user/image", uploadAvatarHandle).Methods(http.MethodPost)
+	authRoutes.HandleFunc("/user/export", requestDataExportHandle).Methods(http.MethodPost)
+	authRoutes.HandleFunc("/user/export", getDataExportHandle).Methods(http.MethodGet)
+	authRoutes.HandleFunc("/users/logout", logoutHandle).Methods(http.MethodPost)
+	authRoutes.HandleFunc("/users/verify/resend", resendVerificationHandle).Methods(http.MethodPost)
+	authRoutes.HandleFunc("/user/2fa/totp", enrollTOTPHandle).Methods(http.MethodPost)
+	authRoutes.HandleFunc("/user/2fa/totp/confirm", confirmTOTPHandle).Methods(http.MethodPost)
+	authRoutes.HandleFunc("/user/2fa/totp/disable", disableTOTPHandle).Methods(http.MethodPost)
+	authRoutes.HandleFunc("/user/tokens", listAccessTokensHandle).Methods(http.MethodGet)
+	authRoutes.HandleFunc("/user/tokens", createAccessTokenHandle).Methods(http.MethodPost)
+	authRoutes.HandleFunc("/user/tokens/{id}", deleteAccessTokenHandle).Methods(http.MethodDelete)
+	authRoutes.HandleFunc("/user/sessions", listSessionsHandle).Methods(http.MethodGet)
+	authRoutes.HandleFunc("/user/sessions/{id}", deleteSessionHandle).Methods(http.MethodDelete)
+	authRoutes.HandleFunc("/user/blocks", listBlocksHandle).Methods(http.MethodGet)
+	authRoutes.HandleFunc("/user/blocks/{username}", blockHandle).Methods(http.MethodPost)
+	authRoutes.HandleFunc("/user/blocks/{username}", unblockHandle).Methods(http.MethodDelete)
+	authRoutes.HandleFunc("/user/mutes", listMutesHandle).Methods(http.MethodGet)
+	authRoutes.HandleFunc("/user/mutes/{username}", muteHandle).Methods(http.MethodPost)
+	authRoutes.HandleFunc("/user/mutes/{username}", unmuteHandle).Methods(http.MethodDelete)
+	authRoutes.HandleFunc("/user/follow-requests", listFollowRequestsHandle).Methods(http.MethodGet)
+	authRoutes.HandleFunc("/user/follow-requests/{username}", approveFollowRequestHandle).Methods(http.MethodPost)
+	authRoutes.HandleFunc("/user/follow-requests/{username}", rejectFollowRequestHandle).Methods(http.MethodDelete)
+	authRoutes.HandleFunc("/user/notifications", listNotificationsHandle).Methods(http.MethodGet)
+	authRoutes.HandleFunc("/user/notifications/read", markAllNotificationsReadHandle).Methods(http.MethodPost)
+	authRoutes.HandleFunc("/user/notifications/{id}/read", markNotificationReadHandle).Methods(http.MethodPost)
 	authRoutes.HandleFunc("/profiles/{username}/follow", followHandle).Methods(http.MethodPost)
 	authRoutes.HandleFunc("/profiles/{username}/follow", unfollowHandle).Methods(http.MethodDelete)
+	authRoutes.HandleFunc("/profiles/{username}/role", setUserRoleHandle).Methods(http.MethodPut)
+	authRoutes.HandleFunc("/admin/audit", listAuditEventsHandle).Methods(http.MethodGet)
 	authRoutes.HandleFunc("/articles", createArticleHandle).Methods(http.MethodPost)
 	authRoutes.HandleFunc("/articles/feed", feedArticlesHandle).Methods(http.MethodGet)
 	authRoutes.HandleFunc("/articles/{slug}", deleteArticleHandle).Methods(http.MethodDelete)
@@ -23,9 +51,24 @@ func UseRoutes(r *mux.Router) {
 	authRoutes.HandleFunc("/articles/{slug}/comments/{commentId}", deleteCommentHandle).Methods(http.MethodDelete)
 
 	r.HandleFunc("/ping", ping).Methods(http.MethodGet)
+	r.HandleFunc("/.well-known/jwks.json", jwksHandle).Methods(http.MethodGet)
 	r.HandleFunc("/users", createUserHandle).Methods(http.MethodPost)
 	r.HandleFunc("/users/login", signInHandle).Methods(http.MethodPost)
+	r.HandleFunc("/users/login/2fa", signInTwoFactorHandle).Methods(http.MethodPost)
+	r.HandleFunc("/users/oidc", listOIDCProvidersHandle).Methods(http.MethodGet)
+	r.HandleFunc("/users/oidc/{provider}/authorize", startOIDCHandle).Methods(http.MethodPost)
+	r.HandleFunc("/users/oidc/{provider}/callback", finishOIDCHandle).Methods(http.MethodPost)
+	r.HandleFunc("/users/refresh", refreshTokenHandle).Methods(http.MethodPost)
+	r.HandleFunc("/users/password/forgot", forgotPasswordHandle).Methods(http.MethodPost)
+	r.HandleFunc("/users/password/reset", resetPasswordHandle).Methods(http.MethodPost)
+	r.HandleFunc("/users/verify", verifyEmailHandle).Methods(http.MethodPost)
+	r.HandleFunc("/users/unlock", unlockAccountHandle).Methods(http.MethodPost)
+	r.HandleFunc("/users/export/{token}", downloadDataExportHandle).Methods(http.MethodGet)
+	r.HandleFunc("/images/{key:.+}", imageHandle).Methods(http.MethodGet)
+	r.HandleFunc("/profiles", searchProfilesHandle).Methods(http.MethodGet)
 	r.HandleFunc("/profiles/{username}", getProfileHandle).Methods(http.MethodGet)
+	r.HandleFunc("/profiles/{username}/followers", listFollowersHandle).Methods(http.MethodGet)
+	r.HandleFunc("/profiles/{username}/following", listFollowingHandle).Methods(http.MethodGet)
 	r.HandleFunc("/articles/{slug}", getArticleHandle).Methods(http.MethodGet)
 	r.HandleFunc("/articles", listArticlesHandle).Methods(http.MethodGet)
 	r.HandleFunc("/tags", getAllTagsHandle).Methods(http.MethodGet)
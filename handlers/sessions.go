@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"../domain"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+)
+
+func listSessionsHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	sessions, err := domain.ListSessions(actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write(respToByte(*sessions, "sessions")))
+}
+
+func deleteSessionHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	vars := mux.Vars(r)
+	err := domain.DeleteSession(vars["id"], actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write([]byte{}))
+}
@@ -2,14 +2,17 @@ package handlers
 
 import (
 	"../api_errors"
-	"../auth"
 	"../domain"
+	"../utils"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -21,6 +24,51 @@ func readRequest(r *http.Request) ([]byte, error) {
 	return body, nil
 }
 
+// Reads request json of form {"field": {...}} into value
+func readRequestField(r *http.Request, field string, value interface{}) *api_errors.E {
+	data, readErr := readRequest(r)
+	if readErr != nil {
+		return api_errors.NewError(http.StatusBadRequest).Add("body", readErr.Error())
+	}
+	var requestData map[string]json.RawMessage
+	err := json.Unmarshal(data, &requestData)
+	if err != nil {
+		return api_errors.NewError(http.StatusBadRequest).Add("body", "could not read request json")
+	}
+	fieldData, found := requestData[field]
+	if !found {
+		return api_errors.NewError(http.StatusBadRequest).Add(field, fmt.Sprintf("request should contain %s field", field))
+	}
+	fieldErr := json.Unmarshal(fieldData, value)
+	if fieldErr != nil {
+		return api_errors.NewError(http.StatusBadRequest).Add("body", "could not read request json")
+	}
+	return nil
+}
+
+// True when the comma separated include query parameter lists name
+func hasInclude(r *http.Request, name string) bool {
+	for _, include := range strings.Split(r.URL.Query().Get("include"), ",") {
+		if strings.TrimSpace(include) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Limit and offset query parameters, 0 when missing or invalid
+func pageFromRequest(r *http.Request) (uint, uint) {
+	var limit, offset uint
+	values := r.URL.Query()
+	if l, err := strconv.ParseUint(values.Get("limit"), 10, 32); err == nil {
+		limit = uint(l)
+	}
+	if o, err := strconv.ParseUint(values.Get("offset"), 10, 32); err == nil {
+		offset = uint(o)
+	}
+	return limit, offset
+}
+
 func createUserSerialize(data []byte) (domain.UserCreate, error) {
 	var requestData map[string]domain.UserCreate
 	err := json.Unmarshal(data, &requestData)
@@ -101,7 +149,7 @@ func createUserHandle(w http.ResponseWriter, r *http.Request) {
 		readErr.Send(w)
 		return
 	}
-	user, err := domain.CreateUser(userData)
+	user, err := domain.CreateUser(userData, clientFromRequest(r))
 	if err != nil {
 		err.Send(w)
 		return
@@ -115,7 +163,7 @@ func signInHandle(w http.ResponseWriter, r *http.Request) {
 		readErr.Send(w)
 		return
 	}
-	user, err := domain.SignIn(userData)
+	user, err := domain.SignIn(userData, clientFromRequest(r))
 	if err != nil {
 		err.Send(w)
 		return
@@ -124,8 +172,8 @@ func signInHandle(w http.ResponseWriter, r *http.Request) {
 }
 
 func getUserHandle(w http.ResponseWriter, r *http.Request) {
-	token, _ := GetTokenFromRequest(r)
-	user, userErr := domain.GetUser(token)
+	actor := actorFromRequest(r)
+	user, userErr := domain.GetUser(actor)
 	if userErr != nil {
 		userErr.Send(w)
 		return
@@ -155,39 +203,72 @@ func userUpdateRead(r *http.Request) (domain.UserUpdate, *api_errors.E) {
 }
 
 func updateUserHandle(w http.ResponseWriter, r *http.Request) {
-	token, _ := GetTokenFromRequest(r)
-	user, userErr := domain.GetUser(token)
-	if userErr != nil {
-		userErr.Send(w)
-		return
-	}
-	tokenEmail, emailErr := auth.GetEmailFromTokenString(token)
-	if emailErr != nil {
-		api_errors.NewError(http.StatusForbidden).Add("email", "token should contain email info").Send(w)
+	actor := actorFromRequest(r)
+	userUpdate, readErr := userUpdateRead(r)
+	if readErr != nil {
+		readErr.Send(w)
 		return
 	}
-	if user.Email != tokenEmail {
-		api_errors.NewError(http.StatusForbidden).Add("email", "cannot update other users").Send(w)
+	userResponse, err := domain.UpdateUser(userUpdate, actor)
+	if err != nil {
+		err.Send(w)
 		return
 	}
-	userUpdate, readErr := userUpdateRead(r)
+	log.Println(w.Write(respToByte(userResponse, "user")))
+}
+
+func deleteUserHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	var accountDelete domain.AccountDelete
+	readErr := readRequestField(r, "user", &accountDelete)
 	if readErr != nil {
 		readErr.Send(w)
 		return
 	}
-	userResponse, err := domain.UpdateUser(userUpdate, token)
+	err := domain.DeleteAccount(accountDelete, actor)
 	if err != nil {
 		err.Send(w)
 		return
 	}
-	log.Println(w.Write(respToByte(userResponse, "user")))
+	log.Println(w.Write([]byte{}))
 }
 
-func getProfileHandle(w http.ResponseWriter, r *http.Request) {
-	token, tErr := GetTokenFromRequest(r)
-	if tErr != nil {
-		token = ""
+func searchProfilesHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	values := r.URL.Query()
+	search := domain.ProfileSearch{Query: values.Get("query"), Sort: values.Get("sort")}
+	search.Limit, search.Offset = pageFromRequest(r)
+	profiles, count, err := domain.SearchProfiles(search, actor)
+	if err != nil {
+		err.Send(w)
+		return
 	}
+	newResponse().addField("profiles", *profiles).addField("profilesCount", count).send(w)
+}
+
+func listFollowersHandle(w http.ResponseWriter, r *http.Request) {
+	listFollowsHandle(w, r, domain.ListFollowers)
+}
+
+func listFollowingHandle(w http.ResponseWriter, r *http.Request) {
+	listFollowsHandle(w, r, domain.ListFollowing)
+}
+
+func listFollowsHandle(w http.ResponseWriter, r *http.Request,
+	list func(string, uint, uint, *domain.Actor) (*[]domain.Profile, uint, *api_errors.E)) {
+	actor := actorFromRequest(r)
+	vars := mux.Vars(r)
+	limit, offset := pageFromRequest(r)
+	profiles, count, err := list(vars["username"], limit, offset, actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	newResponse().addField("profiles", *profiles).addField("profilesCount", count).send(w)
+}
+
+func getProfileHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
 	vars := mux.Vars(r)
 	username := vars["username"]
 	if username == "" {
@@ -195,7 +276,11 @@ func getProfileHandle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	profile, err := domain.GetProfile(username, token)
+	getProfile := domain.GetProfile
+	if hasInclude(r, "stats") {
+		getProfile = domain.GetProfileWithStats
+	}
+	profile, err := getProfile(username, actor)
 	if err != nil {
 		err.Send(w)
 		return
@@ -204,14 +289,14 @@ func getProfileHandle(w http.ResponseWriter, r *http.Request) {
 }
 
 func followHandle(w http.ResponseWriter, r *http.Request) {
-	token, _ := GetTokenFromRequest(r)
+	actor := actorFromRequest(r)
 	vars := mux.Vars(r)
 	username := vars["username"]
 	if username == "" {
 		api_errors.NewError(http.StatusBadRequest).Add("username", "follow request should contain username").Send(w)
 		return
 	}
-	profile, err := domain.FollowUser(username, token)
+	profile, err := domain.FollowUser(username, actor)
 	if err != nil {
 		err.Send(w)
 		return
@@ -220,14 +305,14 @@ func followHandle(w http.ResponseWriter, r *http.Request) {
 }
 
 func unfollowHandle(w http.ResponseWriter, r *http.Request) {
-	token, _ := GetTokenFromRequest(r)
+	actor := actorFromRequest(r)
 	vars := mux.Vars(r)
 	username := vars["username"]
 	if username == "" {
 		api_errors.NewError(http.StatusBadRequest).Add("username", "follow request should contain username").Send(w)
 		return
 	}
-	profile, err := domain.UnfollowUser(username, token)
+	profile, err := domain.UnfollowUser(username, actor)
 	if err != nil {
 		err.Send(w)
 		return
@@ -235,6 +320,102 @@ func unfollowHandle(w http.ResponseWriter, r *http.Request) {
 	log.Println(w.Write(respToByte(profile, "profile")))
 }
 
+// Client address is taken from X-Forwarded-For only behind a trusted proxy, otherwise anyone could pick their own
+func clientFromRequest(r *http.Request) domain.Client {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	if utils.TrustProxy() {
+		forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+		// the last address is the one our proxy has seen
+		if last := strings.TrimSpace(forwarded[len(forwarded)-1]); last != "" {
+			ip = last
+		}
+	}
+	return domain.Client{IP: ip, UserAgent: r.UserAgent()}
+}
+
+func refreshTokenHandle(w http.ResponseWriter, r *http.Request) {
+	var refresh domain.TokenRefresh
+	readErr := readRequestField(r, "user", &refresh)
+	if readErr != nil {
+		readErr.Send(w)
+		return
+	}
+	user, err := domain.RefreshToken(refresh)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write(respToByte(user, "user")))
+}
+
+func logoutHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	err := domain.Logout(actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write([]byte{}))
+}
+
+func forgotPasswordHandle(w http.ResponseWriter, r *http.Request) {
+	var forgot domain.PasswordForgot
+	readErr := readRequestField(r, "user", &forgot)
+	if readErr != nil {
+		readErr.Send(w)
+		return
+	}
+	err := domain.ForgotPassword(forgot, clientFromRequest(r))
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write([]byte{}))
+}
+
+func resetPasswordHandle(w http.ResponseWriter, r *http.Request) {
+	var reset domain.PasswordReset
+	readErr := readRequestField(r, "user", &reset)
+	if readErr != nil {
+		readErr.Send(w)
+		return
+	}
+	user, err := domain.ResetPassword(reset, clientFromRequest(r))
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write(respToByte(user, "user")))
+}
+
+func verifyEmailHandle(w http.ResponseWriter, r *http.Request) {
+	var verify domain.EmailVerify
+	readErr := readRequestField(r, "user", &verify)
+	if readErr != nil {
+		readErr.Send(w)
+		return
+	}
+	err := domain.VerifyEmail(verify)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write([]byte{}))
+}
+
+func resendVerificationHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	err := domain.ResendVerificationEmail(actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write([]byte{}))
+}
+
 func GetTokenFromRequest(r *http.Request) (string, error) {
 	h := r.Header.Get("Authorization")
 	if h == "" || len(h) == 0 {
@@ -248,6 +429,48 @@ func GetTokenFromRequest(r *http.Request) (string, error) {
 	return token, nil
 }
 
+// Scope a token needs for an authenticated route, by method and path template.
+// Routes that are not listed need a full session, personal access tokens can not use them
+var routeScopes = map[string]string{
+	"GET /user":                                    domain.ScopeRead,
+	"GET /articles/feed":                           domain.ScopeRead,
+	"POST /profiles/{username}/follow":             domain.ScopeProfilesWrite,
+	"DELETE /profiles/{username}/follow":           domain.ScopeProfilesWrite,
+	"GET /user/blocks":                             domain.ScopeRead,
+	"POST /user/blocks/{username}":                 domain.ScopeProfilesWrite,
+	"DELETE /user/blocks/{username}":               domain.ScopeProfilesWrite,
+	"GET /user/mutes":                              domain.ScopeRead,
+	"POST /user/mutes/{username}":                  domain.ScopeProfilesWrite,
+	"DELETE /user/mutes/{username}":                domain.ScopeProfilesWrite,
+	"GET /user/follow-requests":                    domain.ScopeRead,
+	"POST /user/follow-requests/{username}":        domain.ScopeProfilesWrite,
+	"DELETE /user/follow-requests/{username}":      domain.ScopeProfilesWrite,
+	"GET /user/notifications":                      domain.ScopeRead,
+	"POST /articles":                               domain.ScopeArticlesWrite,
+	"PUT /articles/{slug}":                         domain.ScopeArticlesWrite,
+	"DELETE /articles/{slug}":                      domain.ScopeArticlesWrite,
+	"POST /articles/{slug}/favorite":               domain.ScopeArticlesWrite,
+	"DELETE /articles/{slug}/favorite":             domain.ScopeArticlesWrite,
+	"POST /articles/{slug}/comments":               domain.ScopeCommentsWrite,
+	"DELETE /articles/{slug}/comments/{commentId}": domain.ScopeCommentsWrite,
+}
+
+func requiredScope(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return domain.ScopeSession
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return domain.ScopeSession
+	}
+	scope, found := routeScopes[r.Method+" "+template]
+	if !found {
+		return domain.ScopeSession
+	}
+	return scope
+}
+
 func AuthRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token, err := GetTokenFromRequest(r)
@@ -255,11 +478,49 @@ func AuthRequest(next http.Handler) http.Handler {
 			api_errors.NewError(http.StatusUnauthorized).Add("Auth", err.Error()).Send(w)
 			return
 		}
-		valErr := auth.ValidateTokenString(token)
-		if valErr != nil {
-			api_errors.NewError(http.StatusUnauthorized).Add("Auth", valErr.Error()).Send(w)
+		actor, authErr := domain.Authenticate(token, clientFromRequest(r))
+		if authErr != nil {
+			authErr.Send(w)
+			return
+		}
+		scopeErr := actor.Require(requiredScope(r))
+		if scopeErr != nil {
+			scopeErr.Send(w)
 			return
 		}
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), actorKey{}, actor)))
 	})
 }
+
+type actorKey struct{}
+
+// Actor resolved by AuthRequest. On public routes the token is optional,
+// an anonymous request or a token that does not authenticate gives nil actor
+func actorFromRequest(r *http.Request) *domain.Actor {
+	if actor, ok := r.Context().Value(actorKey{}).(*domain.Actor); ok {
+		return actor
+	}
+	token, err := GetTokenFromRequest(r)
+	if err != nil {
+		return nil
+	}
+	actor, _ := domain.Authenticate(token, clientFromRequest(r))
+	return actor
+}
+
+func setUserRoleHandle(w http.ResponseWriter, r *http.Request) {
+	actor := actorFromRequest(r)
+	vars := mux.Vars(r)
+	var update domain.RoleUpdate
+	readErr := readRequestField(r, "user", &update)
+	if readErr != nil {
+		readErr.Send(w)
+		return
+	}
+	result, err := domain.SetUserRole(vars["username"], update, actor)
+	if err != nil {
+		err.Send(w)
+		return
+	}
+	log.Println(w.Write(respToByte(result, "user")))
+}
@@ -0,0 +1,78 @@
+package mail
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(m Message) error
+}
+
+// Writes every message to its own file in Dir, or to Out when Dir is empty.
+// Used in development and tests where there is no SMTP server
+type LocalMailer struct {
+	Dir string
+	Out io.Writer
+	mu  sync.Mutex
+}
+
+func NewLocalMailer(dir string) *LocalMailer {
+	return &LocalMailer{Dir: dir, Out: os.Stdout}
+}
+
+func (m Message) String() string {
+	return fmt.Sprintf(
+		"To: %s\r\nSubject: %s\r\nDate: %s\r\n\r\n%s\r\n",
+		m.To,
+		m.Subject,
+		time.Now().UTC().Format(time.RFC1123Z),
+		m.Body,
+	)
+}
+
+func (l *LocalMailer) Send(m Message) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.Dir == "" {
+		_, err := io.WriteString(l.Out, m.String())
+		return err
+	}
+	err := os.MkdirAll(l.Dir, 0700)
+	if err != nil {
+		return fmt.Errorf("could not create mail directory: %s", err)
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), fileSafe(m.To))
+	return ioutil.WriteFile(filepath.Join(l.Dir, name), []byte(m.String()), 0600)
+}
+
+func fileSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '@' || r == '-' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+var mailer Mailer = NewLocalMailer("")
+
+func SetMailer(m Mailer) {
+	mailer = m
+}
+
+func Send(m Message) error {
+	return mailer.Send(m)
+}
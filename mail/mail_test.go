@@ -0,0 +1,40 @@
+package mail_test
+
+import (
+	"../mail"
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalMailerWritesFiles(t *testing.T) {
+	dir := t.TempDir()
+	m := mail.NewLocalMailer(dir)
+	err := m.Send(mail.Message{To: "u22@u", Subject: "subject", Body: "body"})
+	if err != nil {
+		t.Fatalf("could not send message: %s", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("expected one message file, got %d", len(files))
+	}
+	content, _ := ioutil.ReadFile(files[0])
+	if !strings.Contains(string(content), "To: u22@u") || !strings.Contains(string(content), "body") {
+		t.Fatalf("message file has wrong content: %s", content)
+	}
+}
+
+func TestLocalMailerWritesToOut(t *testing.T) {
+	var out bytes.Buffer
+	m := mail.NewLocalMailer("")
+	m.Out = &out
+	err := m.Send(mail.Message{To: "u22@u", Subject: "subject", Body: "body"})
+	if err != nil {
+		t.Fatalf("could not send message: %s", err)
+	}
+	if !strings.Contains(out.String(), "Subject: subject") {
+		t.Fatalf("message was not written: %s", out.String())
+	}
+}
@@ -2,12 +2,18 @@ package main
 
 import (
 	"./DB"
+	"./domain"
 	"./handlers"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
 
 	"./auth"
+	"./mail"
 	"./models"
+	"./oidc"
+	"./storage"
 	"./utils"
 	"log"
 	"time"
@@ -25,7 +31,27 @@ func main() {
 	router := mux.NewRouter()
 	handlers.UseRoutes(router)
 	models.AutoMigrate()
+	skippedAdmins, adminErr := models.SetRoleByEmails(utils.AdminEmails(), models.RoleAdmin)
+	if adminErr != nil {
+		log.Printf("could not set up admins: %s", adminErr)
+	}
+	for _, email := range skippedAdmins {
+		log.Printf("warning: %s is in ADMIN_EMAILS but no user verified it, it is not made admin", email)
+	}
+	auth.SetAccessTokenTTL(utils.AccessTokenTTL())
+	auth.SetRefreshTokenTTL(utils.RefreshTokenTTL())
+	emailTokensUntil, untilErr := utils.EmailTokensAcceptedUntil()
+	if untilErr != nil {
+		panic(fmt.Sprintf("could not read EMAIL_TOKENS_ACCEPTED_UNTIL: %s", untilErr))
+	}
+	domain.SetEmailTokensAcceptedUntil(emailTokensUntil)
 	SetSignature()
+	mail.SetMailer(mail.NewLocalMailer(utils.MailDir()))
+	storage.SetStorage(storage.NewLocalStorage(utils.StorageDir()))
+	go domain.PurgeDataExports(time.Hour)
+	domain.SetVerifiedEmailRequired(utils.RequireVerifiedEmail())
+	SetPasswordPolicy()
+	SetOIDCProviders()
 	port := utils.Port()
 	host := utils.Host()
 	srv := &http.Server{
@@ -58,4 +84,47 @@ func SetSignature() {
 	if s != "" {
 		auth.SetSignature(s)
 	}
+	keysFile := utils.SigningKeysFile()
+	if keysFile != "" {
+		err := auth.LoadKeyringFile(keysFile)
+		if err != nil {
+			panic(fmt.Sprintf("could not load signing keys: %s", err))
+		}
+		for _, kid := range auth.PruneRetiredKeys() {
+			log.Printf("signing key %s is retired and has no valid tokens left, it can be removed from %s", kid, keysFile)
+		}
+	}
+}
+
+func SetPasswordPolicy() {
+	banned := domain.DefaultBannedPasswords
+	bannedFile := utils.PasswordBannedFile()
+	if bannedFile != "" {
+		data, err := ioutil.ReadFile(bannedFile)
+		if err != nil {
+			panic(fmt.Sprintf("could not read banned passwords: %s", err))
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if p := strings.TrimSpace(line); p != "" {
+				banned = append(banned, p)
+			}
+		}
+	}
+	domain.SetPasswordPolicy(domain.PasswordPolicy{
+		MinLength:   utils.PasswordMinLength(),
+		MaxLength:   utils.PasswordMaxLength(),
+		Banned:      banned,
+		BreachedDir: utils.BreachedPasswordsDir(),
+	})
+}
+
+func SetOIDCProviders() {
+	providersFile := utils.OIDCProvidersFile()
+	if providersFile == "" {
+		return
+	}
+	err := oidc.LoadProvidersFile(providersFile)
+	if err != nil {
+		panic(fmt.Sprintf("could not load oidc providers: %s", err))
+	}
 }
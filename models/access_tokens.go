@@ -0,0 +1,64 @@
+package models
+
+import (
+	"../DB"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// Named long lived token a user creates for automation, limited to Scopes (space separated).
+// Deleting it revokes it
+type AccessToken struct {
+	gorm.Model
+	UserID     uint `gorm:"index"`
+	Name       string
+	TokenHash  string `gorm:"unique_index"`
+	Prefix     string
+	Scopes     string
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+}
+
+func CreateAccessToken(token *AccessToken) error {
+	db := DB.Get()
+	return db.Create(token).Error
+}
+
+func GetAccessToken(tokenHash string) (*AccessToken, error) {
+	db := DB.Get()
+	var token AccessToken
+	err := db.Where(&AccessToken{TokenHash: tokenHash}).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func ListAccessTokens(userID uint) (*[]AccessToken, error) {
+	db := DB.Get()
+	var tokens []AccessToken
+	err := db.Where(&AccessToken{UserID: userID}).Order("created_at DESC").Find(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+	return &tokens, nil
+}
+
+// Returns false if user has no such token
+func DeleteAccessToken(userID uint, id uint) (bool, error) {
+	db := DB.Get()
+	result := db.Where(&AccessToken{UserID: userID}).Delete(&AccessToken{}, id)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Updates last use at most once a minute, so busy bots do not write on every request
+func TouchAccessToken(id uint) error {
+	db := DB.Get()
+	now := time.Now()
+	return db.Model(&AccessToken{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, now.Add(-time.Minute)).
+		UpdateColumn("last_used_at", now).Error
+}
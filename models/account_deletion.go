@@ -0,0 +1,121 @@
+package models
+
+import (
+	"../DB"
+	"fmt"
+	"github.com/jinzhu/gorm"
+)
+
+// Placeholder author of content kept after its author deleted their account.
+// It has no password and its email can not receive mail, so nobody can sign in as it.
+// It is found by the placeholder column, the email and username are only reserved for it
+const (
+	DeletedUserEmail    = "deleted-user@users.invalid"
+	DeletedUserUsername = "deleted user"
+)
+
+// Removes user and every row that belongs to them in one transaction.
+// With anonymize the articles and comments of user are moved to the deleted user placeholder,
+// otherwise they are deleted together with tags, favorites and comments of other users on them.
+// Audit events are kept, the audit log is append only
+func DeleteUser(userID uint, anonymize bool) error {
+	db := DB.Get()
+	return db.Transaction(func(tx *gorm.DB) error {
+		var user User
+		err := tx.First(&user, userID).Error
+		if err != nil {
+			return err
+		}
+
+		if anonymize {
+			placeholder, placeholderErr := deletedUser(tx)
+			if placeholderErr != nil {
+				return placeholderErr
+			}
+			err = tx.Unscoped().Model(&Article{}).Where("author_id = ?", userID).
+				Update("author_id", placeholder.ID).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Unscoped().Model(&Comment{}).Where("author_id = ?", userID).
+				Update("author_id", placeholder.ID).Error
+			if err != nil {
+				return err
+			}
+		} else {
+			articles := tx.Unscoped().Model(&Article{}).Select("id").Where("author_id = ?", userID).SubQuery()
+			steps := []*gorm.DB{
+				tx.Where("article_id IN ?", articles).Delete(&Tag{}),
+				tx.Where("article_id IN ?", articles).Delete(&Favorite{}),
+				tx.Unscoped().Where("article_id IN ?", articles).Delete(&Comment{}),
+				tx.Unscoped().Where("author_id = ?", userID).Delete(&Comment{}),
+				tx.Unscoped().Where("author_id = ?", userID).Delete(&Article{}),
+			}
+			for _, step := range steps {
+				if step.Error != nil {
+					return step.Error
+				}
+			}
+		}
+
+		steps := []*gorm.DB{
+			tx.Where("user_id = ?", userID).Delete(&Favorite{}),
+			tx.Where("following_id = ? OR followed_by_id = ?", userID, userID).Delete(&Follow{}),
+			tx.Where("blocker_id = ? OR blocked_id = ?", userID, userID).Delete(&Block{}),
+			tx.Where("muter_id = ? OR muted_id = ?", userID, userID).Delete(&Mute{}),
+			tx.Where("requester_id = ? OR target_id = ?", userID, userID).Delete(&FollowRequest{}),
+			tx.Where("notification_id IN (SELECT id FROM notifications WHERE user_id = ?) OR actor_id = ?", userID, userID).
+				Delete(&NotificationActor{}),
+			// notifications only the deleted user caused are left without actors
+			tx.Where("user_id = ? OR NOT EXISTS (SELECT 1 FROM notification_actors "+
+				"WHERE notification_actors.notification_id = notifications.id)", userID).Delete(&Notification{}),
+			tx.Unscoped().Where("user_id = ?", userID).Delete(&RefreshToken{}),
+			tx.Where("user_id = ?", userID).Delete(&Session{}),
+			tx.Unscoped().Where("user_id = ?", userID).Delete(&AccessToken{}),
+			tx.Unscoped().Where("user_id = ?", userID).Delete(&PasswordReset{}),
+			tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}),
+			tx.Where("user_id = ?", userID).Delete(&UserIdentity{}),
+			tx.Where("user_id = ?", userID).Delete(&DataExport{}),
+			tx.Where("key = ?", "email:"+user.Email).Delete(&LoginThrottle{}),
+			tx.Delete(&User{}, userID),
+		}
+		for _, step := range steps {
+			if step.Error != nil {
+				return step.Error
+			}
+		}
+		return nil
+	})
+}
+
+func deletedUser(tx *gorm.DB) (*User, error) {
+	var placeholder User
+	err := tx.Where("placeholder = ?", true).First(&placeholder).Error
+	if err != nil {
+		return nil, err
+	}
+	return &placeholder, nil
+}
+
+// Creates the deleted user placeholder. A passwordless user with its email is the placeholder
+// made by older versions. A user with a password registered the email, so anonymizing deletions
+// fail until an admin changes that email, rather than handing deleted content to them
+func migrateDeletedUser(db *gorm.DB) error {
+	var count int
+	err := db.Model(&User{}).Where("placeholder = ?", true).Count(&count).Error
+	if err != nil || count > 0 {
+		return err
+	}
+	var existing User
+	err = db.Where("email = ?", DeletedUserEmail).First(&existing).Error
+	if err == nil {
+		if existing.PasswordHash != "" {
+			return fmt.Errorf("user %d registered the placeholder email %s", existing.ID, DeletedUserEmail)
+		}
+		return db.Model(&existing).UpdateColumn("placeholder", true).Error
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+	return db.Create(&User{Email: DeletedUserEmail, Username: DeletedUserUsername, Role: RoleUser, Placeholder: true}).Error
+}
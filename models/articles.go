@@ -12,8 +12,8 @@ type Article struct {
 	Title       string
 	Description string `gorm:"size:2048"`
 	Body        string `gorm:"size:2048"`
-	AuthorID    uint
-	Author      User `gorm:"foreignKey:AuthorID"`
+	AuthorID    uint   `gorm:"index"`
+	Author      User   `gorm:"foreignKey:AuthorID"`
 }
 
 type Tag struct {
@@ -22,8 +22,8 @@ type Tag struct {
 }
 
 type Favorite struct {
-	ArticleID uint
-	UserID    uint
+	ArticleID uint `gorm:"index"`
+	UserID    uint `gorm:"index"`
 }
 
 type Comment struct {
@@ -202,8 +202,14 @@ func ListArticles(tag string, authorID uint, favoritedByID uint, limit uint, off
 		}
 	}
 
+	// articles the viewer may not see are left out before LIMIT, so they do not take up page slots
+	visible := "WHERE author_id NOT IN " + privateAuthors(userID) + " "
+	if userID != 0 {
+		visible += "AND author_id NOT IN " + hiddenAuthors(userID) + " "
+	}
+
 	dataQuery := "SELECT * " +
-		fmt.Sprintf("FROM (SELECT *, id as articleID FROM articles LIMIT %d OFFSET %d) as articles ", limit, offset) +
+		fmt.Sprintf("FROM (SELECT *, id as articleID FROM articles %sLIMIT %d OFFSET %d) as articles ", visible, limit, offset) +
 		query //+
 	//" ORDER BY articles.created_at DESC"
 	// TODO
@@ -218,7 +224,7 @@ func ListArticles(tag string, authorID uint, favoritedByID uint, limit uint, off
 	}
 	var rowCount Count
 	countQuery := "SELECT COUNT ( DISTINCT articleID ) AS Count " +
-		"FROM (SELECT id, author_id, id as articleID FROM articles ) as articles " +
+		"FROM (SELECT id, author_id, id as articleID FROM articles " + visible + ") as articles " +
 		query
 	cErr := db.Raw(countQuery).Scan(&rowCount).Error
 	if cErr != nil {
@@ -254,7 +260,8 @@ func FeedArticles(limit uint, offset uint, userID uint) (*[]ArticlesList, uint,
 	}
 	values = values + ")"
 
-	query := fmt.Sprintf("FROM (SELECT *, id as articleID FROM articles WHERE author_id in %s LIMIT %d OFFSET %d) AS articles ", values, limit, offset) +
+	query := fmt.Sprintf("FROM (SELECT *, id as articleID FROM articles WHERE author_id in %s AND author_id NOT IN %s LIMIT %d OFFSET %d) AS articles ",
+		values, hiddenAuthors(userID), limit, offset) +
 		"LEFT JOIN tags on tags.article_id = articles.id " +
 		"LEFT JOIN users on users.id = articles.author_id " +
 		fmt.Sprintf("LEFT JOIN favorites on favorites.article_id = articles.id and favorites.user_id = %d ", userID)
@@ -307,10 +314,14 @@ func CreateComment(userID uint, articleID uint, body string) (*Comment, error) {
 	return &comment, nil
 }
 
-func GetCommentsForArticle(articleID uint) (*[]CommentList, error) {
+// Comments by authors hidden from viewerID are left out, viewerID 0 sees all
+func GetCommentsForArticle(articleID uint, viewerID uint) (*[]CommentList, error) {
 	db := DB.Get()
 	var comments []CommentList
 	query := fmt.Sprintf("SELECT * FROM comments JOIN articles ON comments.article_id = articles.id JOIN users ON comments.author_id = users.id WHERE comments.article_id = %d", articleID)
+	if viewerID != 0 {
+		query = query + " AND comments.author_id NOT IN " + hiddenAuthors(viewerID)
+	}
 	db.Raw(query).Scan(&comments)
 	err := db.Error
 	if err != nil {
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"../DB"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// Security relevant event. Events are only ever inserted, there is no way to change or delete them here
+type AuditEvent struct {
+	ID        uint      `gorm:"primary_key"`
+	CreatedAt time.Time `gorm:"index"`
+	Type      string    `gorm:"index"`
+	// user the event is about, nil when nobody has the email of a failed sign in
+	UserID *uint `gorm:"index"`
+	// user who did it, differs from UserID when e.g. an admin changes a role
+	ActorID   *uint
+	Email     string
+	IP        string
+	UserAgent string `gorm:"size:512"`
+	Outcome   string
+	Details   string `gorm:"size:1024"`
+}
+
+type AuditFilter struct {
+	UserID *uint
+	Type   string
+	From   *time.Time
+	To     *time.Time
+}
+
+func CreateAuditEvent(event *AuditEvent) error {
+	db := DB.Get()
+	return db.Create(event).Error
+}
+
+func (f AuditFilter) apply(db *gorm.DB) *gorm.DB {
+	if f.UserID != nil {
+		db = db.Where("user_id = ?", *f.UserID)
+	}
+	if f.Type != "" {
+		db = db.Where("type = ?", f.Type)
+	}
+	if f.From != nil {
+		db = db.Where("created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		db = db.Where("created_at < ?", *f.To)
+	}
+	return db
+}
+
+// Newest events first
+func ListAuditEvents(filter AuditFilter, limit uint, offset uint) (*[]AuditEvent, uint, error) {
+	db := filter.apply(DB.Get().Model(&AuditEvent{}))
+	var count uint
+	err := db.Count(&count).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	var events []AuditEvent
+	err = db.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&events).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return &events, count, nil
+}
+
+// Calls fn for every matching event, oldest first, without loading them all in memory
+func EachAuditEvent(filter AuditFilter, fn func(event *AuditEvent) error) error {
+	db := DB.Get()
+	rows, err := filter.apply(db.Model(&AuditEvent{})).Order("created_at, id").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var event AuditEvent
+		scanErr := db.ScanRows(rows, &event)
+		if scanErr != nil {
+			return scanErr
+		}
+		fnErr := fn(&event)
+		if fnErr != nil {
+			return fnErr
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"../DB"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// Blocked user can not follow the blocker or comment on their articles,
+// and neither sees the other's articles and comments
+type Block struct {
+	BlockerID uint `gorm:"primary_key;auto_increment:false"`
+	BlockedID uint `gorm:"primary_key;auto_increment:false"`
+	CreatedAt time.Time
+}
+
+// Articles and comments of the muted user are hidden from the muter, the muted user is not told
+type Mute struct {
+	MuterID   uint `gorm:"primary_key;auto_increment:false"`
+	MutedID   uint `gorm:"primary_key;auto_increment:false"`
+	CreatedAt time.Time
+}
+
+// Subquery of authors whose content userID does not see: muted or blocked by them, or blocking them
+func hiddenAuthors(userID uint) string {
+	return fmt.Sprintf("(SELECT muted_id FROM mutes WHERE muter_id = %d "+
+		"UNION SELECT blocked_id FROM blocks WHERE blocker_id = %d "+
+		"UNION SELECT blocker_id FROM blocks WHERE blocked_id = %d)", userID, userID, userID)
+}
+
+// Blocking removes follows and follow requests in both directions
+func AddBlock(blockerID uint, blockedID uint) error {
+	db := DB.Get()
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("(followed_by_id = ? AND following_id = ?) OR (followed_by_id = ? AND following_id = ?)",
+			blockerID, blockedID, blockedID, blockerID).Delete(&Follow{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("(requester_id = ? AND target_id = ?) OR (requester_id = ? AND target_id = ?)",
+			blockerID, blockedID, blockedID, blockerID).Delete(&FollowRequest{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec("INSERT INTO blocks (blocker_id, blocked_id, created_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+			blockerID, blockedID, time.Now()).Error
+	})
+}
+
+func RemoveBlock(blockerID uint, blockedID uint) error {
+	db := DB.Get()
+	return db.Where(&Block{BlockerID: blockerID, BlockedID: blockedID}).Delete(&Block{}).Error
+}
+
+func IsBlocked(blockerID uint, blockedID uint) bool {
+	db := DB.Get()
+	var count int
+	err := db.Model(&Block{}).Where(&Block{BlockerID: blockerID, BlockedID: blockedID}).Count(&count).Error
+	if err != nil {
+		// fail closed, like revoked tokens
+		return true
+	}
+	return count > 0
+}
+
+func AddMute(muterID uint, mutedID uint) error {
+	db := DB.Get()
+	return db.Exec("INSERT INTO mutes (muter_id, muted_id, created_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+		muterID, mutedID, time.Now()).Error
+}
+
+func RemoveMute(muterID uint, mutedID uint) error {
+	db := DB.Get()
+	return db.Where(&Mute{MuterID: muterID, MutedID: mutedID}).Delete(&Mute{}).Error
+}
+
+func IsMuted(muterID uint, mutedID uint) bool {
+	db := DB.Get()
+	var count int
+	err := db.Model(&Mute{}).Where(&Mute{MuterID: muterID, MutedID: mutedID}).Count(&count).Error
+	if err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// Users blocked by userID, by username
+func ListBlocked(userID uint) (*[]FollowProfile, error) {
+	return listRelated("blocks", "blocked_id", "blocker_id", userID)
+}
+
+// Users muted by userID, by username
+func ListMuted(userID uint) (*[]FollowProfile, error) {
+	return listRelated("mutes", "muted_id", "muter_id", userID)
+}
+
+func listRelated(table string, listed string, owner string, userID uint) (*[]FollowProfile, error) {
+	db := DB.Get()
+	var result []FollowProfile
+	err := db.Raw(fmt.Sprintf("SELECT users.*, EXISTS (SELECT 1 FROM follows "+
+		"WHERE follows.followed_by_id = %[3]s.%[2]s AND follows.following_id = users.id) AS following "+
+		"FROM users JOIN %[3]s ON %[3]s.%[1]s = users.id WHERE %[3]s.%[2]s = ? ORDER BY lower(users.username)",
+		listed, owner, table), userID).Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		result = []FollowProfile{}
+	}
+	return &result, nil
+}
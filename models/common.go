@@ -2,6 +2,7 @@ package models
 
 import (
 	"../DB"
+	"log"
 )
 
 func AutoMigrate() {
@@ -12,4 +13,36 @@ func AutoMigrate() {
 	db.AutoMigrate(&Tag{})
 	db.AutoMigrate(&Favorite{})
 	db.AutoMigrate(&Comment{})
+	db.AutoMigrate(&RefreshToken{})
+	db.AutoMigrate(&RevokedToken{})
+	db.AutoMigrate(&PasswordReset{})
+	db.AutoMigrate(&RecoveryCode{})
+	db.AutoMigrate(&UserIdentity{})
+	db.AutoMigrate(&OIDCLogin{})
+	db.AutoMigrate(&AccessToken{})
+	db.AutoMigrate(&LoginThrottle{})
+	db.AutoMigrate(&Session{})
+	db.AutoMigrate(&AuditEvent{})
+	db.AutoMigrate(&DataExport{})
+	db.AutoMigrate(&Block{})
+	db.AutoMigrate(&Mute{})
+	db.AutoMigrate(&FollowRequest{})
+	db.AutoMigrate(&Notification{})
+	db.AutoMigrate(&NotificationActor{})
+	err := migrateUsernames(db)
+	if err != nil {
+		log.Printf("could not make usernames unique: %s", err)
+	}
+	err = migrateProfileSearch(db)
+	if err != nil {
+		log.Printf("profile search works without trigram matching: %s", err)
+	}
+	err = migrateDeletedUser(db)
+	if err != nil {
+		log.Printf("could not create deleted user placeholder, accounts can not be deleted anonymously: %s", err)
+	}
+	err = migrateNotifications(db)
+	if err != nil {
+		log.Printf("could not index unread notifications: %s", err)
+	}
 }
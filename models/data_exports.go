@@ -0,0 +1,168 @@
+package models
+
+import (
+	"../DB"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+const (
+	DataExportPending = "pending"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+// Archive with the personal data of a user, built in the background and
+// downloaded with the token whose hash is TokenHash until ExpiresAt.
+// The archive itself is in file storage under ArchiveKey
+type DataExport struct {
+	ID         uint   `gorm:"primary_key"`
+	UserID     uint   `gorm:"index"`
+	TokenHash  string `gorm:"unique_index"`
+	Status     string `gorm:"not null;default:'pending'"`
+	ArchiveKey string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+}
+
+// Everything a user wrote or did, for the data export
+type UserData struct {
+	User      User
+	Articles  []Article
+	Tags      map[uint][]string
+	Comments  []CommentExport
+	Favorites []Article
+	Following []User
+	Followers []User
+}
+
+type CommentExport struct {
+	Comment
+	ArticleSlug string
+}
+
+func CreateDataExport(export *DataExport) error {
+	db := DB.Get()
+	return db.Create(export).Error
+}
+
+// Most recent export of user, without the archive key
+func GetLatestDataExport(userID uint) (*DataExport, error) {
+	db := DB.Get()
+	var export DataExport
+	err := db.Select("id, user_id, status, created_at, expires_at").
+		Where(&DataExport{UserID: userID}).Order("created_at DESC").First(&export).Error
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// Export with the archive key, if the token is not expired
+func GetDataExportByToken(tokenHash string) (*DataExport, error) {
+	db := DB.Get()
+	var export DataExport
+	err := db.Where("token_hash = ? AND expires_at > ?", tokenHash, time.Now()).First(&export).Error
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// Fails with gorm.ErrRecordNotFound when the export is gone, e.g. with its account
+func FinishDataExport(id uint, archiveKey string) error {
+	db := DB.Get()
+	result := db.Model(&DataExport{}).Where("id = ? AND status = ?", id, DataExportPending).
+		Updates(map[string]interface{}{"status": DataExportReady, "archive_key": archiveKey})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func FailDataExport(id uint) error {
+	db := DB.Get()
+	return db.Model(&DataExport{}).Where("id = ?", id).Update("status", DataExportFailed).Error
+}
+
+// Deletes expired exports and returns the keys of their archives
+func PurgeExpiredDataExports() ([]string, error) {
+	db := DB.Get()
+	var rows []archiveKeyRow
+	err := db.Raw("DELETE FROM data_exports WHERE expires_at < ? RETURNING COALESCE(archive_key, '') AS archive_key",
+		time.Now()).Scan(&rows).Error
+	return archiveKeys(rows), err
+}
+
+// Keys of the archives of all exports of user
+func GetDataExportKeys(userID uint) ([]string, error) {
+	db := DB.Get()
+	var rows []archiveKeyRow
+	err := db.Raw("SELECT COALESCE(archive_key, '') AS archive_key FROM data_exports WHERE user_id = ?", userID).
+		Scan(&rows).Error
+	return archiveKeys(rows), err
+}
+
+type archiveKeyRow struct {
+	ArchiveKey string
+}
+
+// Pending and failed exports have no archive
+func archiveKeys(rows []archiveKeyRow) []string {
+	keys := []string{}
+	for _, row := range rows {
+		if row.ArchiveKey != "" {
+			keys = append(keys, row.ArchiveKey)
+		}
+	}
+	return keys
+}
+
+func GetUserData(userID uint) (*UserData, error) {
+	db := DB.Get()
+	data := UserData{Tags: map[uint][]string{}}
+	err := db.First(&data.User, userID).Error
+	if err != nil {
+		return nil, err
+	}
+	err = db.Where(&Article{AuthorID: userID}).Order("created_at").Find(&data.Articles).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, article := range data.Articles {
+		tags, tagErr := GetTagsForArticle(article.ID)
+		if tagErr != nil {
+			return nil, tagErr
+		}
+		for _, tag := range *tags {
+			data.Tags[article.ID] = append(data.Tags[article.ID], tag.Name)
+		}
+	}
+	err = db.Raw(fmt.Sprintf("SELECT comments.*, articles.slug AS article_slug FROM comments "+
+		"JOIN articles ON articles.id = comments.article_id "+
+		"WHERE comments.author_id = %d AND comments.deleted_at IS NULL ORDER BY comments.created_at", userID)).
+		Scan(&data.Comments).Error
+	if err != nil {
+		return nil, err
+	}
+	err = db.Joins("JOIN favorites ON favorites.article_id = articles.id").
+		Where("favorites.user_id = ?", userID).Find(&data.Favorites).Error
+	if err != nil {
+		return nil, err
+	}
+	err = db.Joins("JOIN follows ON follows.following_id = users.id").
+		Where("follows.followed_by_id = ?", userID).Find(&data.Following).Error
+	if err != nil {
+		return nil, err
+	}
+	err = db.Joins("JOIN follows ON follows.followed_by_id = users.id").
+		Where("follows.following_id = ?", userID).Find(&data.Followers).Error
+	if err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"../DB"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// Request to follow a private account, waiting for the owner to approve or reject it
+type FollowRequest struct {
+	RequesterID uint `gorm:"primary_key;auto_increment:false"`
+	TargetID    uint `gorm:"primary_key;auto_increment:false;index"`
+	CreatedAt   time.Time
+}
+
+// Subquery of private authors whose articles viewerID may not see: everyone private they do not follow.
+// viewerID 0 is anonymous and sees no private author
+func privateAuthors(viewerID uint) string {
+	return fmt.Sprintf("(SELECT id FROM users WHERE private AND id <> %d "+
+		"AND id NOT IN (SELECT following_id FROM follows WHERE followed_by_id = %d))", viewerID, viewerID)
+}
+
+func CreateFollowRequest(requesterID uint, targetID uint) error {
+	db := DB.Get()
+	return db.Exec("INSERT INTO follow_requests (requester_id, target_id, created_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+		requesterID, targetID, time.Now()).Error
+}
+
+func IsFollowRequested(requesterID uint, targetID uint) bool {
+	db := DB.Get()
+	var count int
+	err := db.Model(&FollowRequest{}).Where(&FollowRequest{RequesterID: requesterID, TargetID: targetID}).Count(&count).Error
+	if err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// Returns false when there was no request
+func DeleteFollowRequest(requesterID uint, targetID uint) (bool, error) {
+	db := DB.Get()
+	result := db.Where(&FollowRequest{RequesterID: requesterID, TargetID: targetID}).Delete(&FollowRequest{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Turns the request into a follow, returns false when there was no request
+func ApproveFollowRequest(requesterID uint, targetID uint) (bool, error) {
+	db := DB.Get()
+	approved := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where(&FollowRequest{RequesterID: requesterID, TargetID: targetID}).Delete(&FollowRequest{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		approved = true
+		return tx.Exec("INSERT INTO follows (following_id, followed_by_id) SELECT ?, ? "+
+			"WHERE NOT EXISTS (SELECT 1 FROM follows WHERE following_id = ? AND followed_by_id = ?)",
+			targetID, requesterID, targetID, requesterID).Error
+	})
+	return approved && err == nil, err
+}
+
+// Pending requests to targetID, oldest first
+func ListFollowRequests(targetID uint) (*[]User, error) {
+	db := DB.Get()
+	var result []User
+	err := db.Joins("JOIN follow_requests ON follow_requests.requester_id = users.id").
+		Where("follow_requests.target_id = ?", targetID).Order("follow_requests.created_at").Find(&result).Error
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		result = []User{}
+	}
+	return &result, nil
+}
+
+// Sets whether the account of userID is private. Pending requests are approved when it becomes public
+func SetUserPrivate(userID uint, private bool) error {
+	db := DB.Get()
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&User{}).Where("id = ?", userID).UpdateColumn("private", private).Error
+		if err != nil || private {
+			return err
+		}
+		err = tx.Exec("INSERT INTO follows (following_id, followed_by_id) "+
+			"SELECT target_id, requester_id FROM follow_requests WHERE target_id = ? "+
+			"AND NOT EXISTS (SELECT 1 FROM follows WHERE following_id = target_id AND followed_by_id = requester_id)", userID).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where(&FollowRequest{TargetID: userID}).Delete(&FollowRequest{}).Error
+	})
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"../DB"
+)
+
+// User with whether the viewer follows them
+type FollowProfile struct {
+	User
+	Following bool
+}
+
+// Users following userID, by username
+func ListFollowers(userID uint, viewerID uint, limit uint, offset uint) (*[]FollowProfile, uint, error) {
+	return listFollows("follows.followed_by_id", "follows.following_id", userID, viewerID, limit, offset)
+}
+
+// Users userID follows, by username
+func ListFollowing(userID uint, viewerID uint, limit uint, offset uint) (*[]FollowProfile, uint, error) {
+	return listFollows("follows.following_id", "follows.followed_by_id", userID, viewerID, limit, offset)
+}
+
+// listed is the follows column joined to users, owner the column matched against userID.
+// The following flag comes from the same query, viewerID 0 matches nobody
+func listFollows(listed string, owner string, userID uint, viewerID uint, limit uint, offset uint) (*[]FollowProfile, uint, error) {
+	db := DB.Get()
+	from := "FROM users JOIN follows ON " + listed + " = users.id WHERE " + owner + " = ? "
+
+	var result []FollowProfile
+	err := db.Raw("SELECT users.*, EXISTS (SELECT 1 FROM follows AS viewer_follows "+
+		"WHERE viewer_follows.followed_by_id = ? AND viewer_follows.following_id = users.id) AS following "+
+		from+"ORDER BY lower(users.username) LIMIT ? OFFSET ?", viewerID, userID, limit, offset).
+		Scan(&result).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var count struct {
+		Count uint
+	}
+	err = db.Raw("SELECT COUNT(*) AS count "+from, userID).Scan(&count).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	if result == nil {
+		result = []FollowProfile{}
+	}
+	return &result, count.Count, nil
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"../DB"
+	"fmt"
+	"time"
+)
+
+// Account at an external OpenID Connect provider linked to a user
+type UserIdentity struct {
+	ID       uint   `gorm:"primary_key"`
+	UserID   uint   `gorm:"index"`
+	Provider string `gorm:"unique_index:idx_identity_provider_subject"`
+	Subject  string `gorm:"unique_index:idx_identity_provider_subject"`
+	Email    string
+}
+
+// Sign in attempt at an external provider, waiting for the provider to redirect back
+type OIDCLogin struct {
+	ID           uint   `gorm:"primary_key"`
+	StateHash    string `gorm:"unique_index"`
+	BindingHash  string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+func GetUserByIdentity(provider string, subject string) (*User, error) {
+	db := DB.Get()
+	var identity UserIdentity
+	err := db.Where(&UserIdentity{Provider: provider, Subject: subject}).First(&identity).Error
+	if err != nil {
+		return nil, err
+	}
+	return GetUserByID(identity.UserID)
+}
+
+func LinkIdentity(userID uint, provider string, subject string, email string) error {
+	db := DB.Get()
+	return db.Create(&UserIdentity{
+		UserID:   userID,
+		Provider: provider,
+		Subject:  subject,
+		Email:    email,
+	}).Error
+}
+
+func CreateOIDCLogin(login *OIDCLogin) error {
+	db := DB.Get()
+	return db.Create(login).Error
+}
+
+// Returns and deletes sign in attempt, so every state can be used once
+func TakeOIDCLogin(stateHash string) (*OIDCLogin, error) {
+	db := DB.Get()
+	var login OIDCLogin
+	err := db.Where(&OIDCLogin{StateHash: stateHash}).First(&login).Error
+	if err != nil {
+		return nil, err
+	}
+	deleted := db.Delete(&OIDCLogin{}, login.ID)
+	if deleted.Error != nil {
+		return nil, deleted.Error
+	}
+	if deleted.RowsAffected == 0 {
+		return nil, fmt.Errorf("sign in attempt was already used")
+	}
+	db.Where("expires_at < ?", time.Now()).Delete(&OIDCLogin{})
+	if login.ExpiresAt.Before(time.Now()) {
+		return nil, fmt.Errorf("sign in attempt expired")
+	}
+	return &login, nil
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"../DB"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// Failed sign in counter for an account ("email:...") or a client address ("ip:...").
+// Failures older than the window passed to RecordLoginFailure start a new count
+type LoginThrottle struct {
+	Key           string `gorm:"primary_key"`
+	Failures      uint   `gorm:"not null;default:0"`
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// Returns empty throttle when key has no failures
+func GetLoginThrottle(key string) (*LoginThrottle, error) {
+	db := DB.Get()
+	var throttle LoginThrottle
+	err := db.Where("key = ?", key).First(&throttle).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &LoginThrottle{Key: key}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+// Atomically counts a failure and returns the new count
+func RecordLoginFailure(key string, window time.Duration) (uint, error) {
+	db := DB.Get()
+	now := time.Now()
+	var failures uint
+	err := db.Raw(
+		`INSERT INTO login_throttles (key, failures, last_failure_at) VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_throttles.last_failure_at < ? THEN 1 ELSE login_throttles.failures + 1 END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING failures`,
+		key, now, now.Add(-window),
+	).Row().Scan(&failures)
+	return failures, err
+}
+
+func LockLogin(key string, until time.Time) error {
+	db := DB.Get()
+	return db.Model(&LoginThrottle{}).Where("key = ?", key).UpdateColumn("locked_until", until).Error
+}
+
+func ClearLoginThrottle(key string) error {
+	db := DB.Get()
+	return db.Where("key = ?", key).Delete(&LoginThrottle{}).Error
+}
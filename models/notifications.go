@@ -0,0 +1,155 @@
+package models
+
+import (
+	"../DB"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+const (
+	NotificationFollow        = "follow"
+	NotificationFollowRequest = "follow_request"
+	NotificationFavorite      = "favorite"
+	NotificationComment       = "comment"
+)
+
+// Activity of other users for UserID. Events of the same Type on the same article are added to
+// the unread notification as actors until it is read, so five favorites make one notification
+type Notification struct {
+	ID        uint `gorm:"primary_key"`
+	UserID    uint `gorm:"index"`
+	Type      string
+	ArticleID *uint
+	CreatedAt time.Time
+	// time of the latest event
+	UpdatedAt time.Time
+	ReadAt    *time.Time
+}
+
+// Users who caused a notification, each counted once
+type NotificationActor struct {
+	NotificationID uint `gorm:"primary_key;auto_increment:false"`
+	ActorID        uint `gorm:"primary_key;auto_increment:false;index"`
+	CreatedAt      time.Time
+}
+
+type NotificationList struct {
+	Notification
+	ArticleSlug  *string
+	ArticleTitle *string
+	ActorsCount  uint
+}
+
+type NotificationActorList struct {
+	NotificationID uint
+	User
+	Following bool
+}
+
+// At most one unread notification per user, type and article, Notify relies on it
+func migrateNotifications(db *gorm.DB) error {
+	return db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_unread_group " +
+		"ON notifications (user_id, type, (COALESCE(article_id, 0))) WHERE read_at IS NULL").Error
+}
+
+// Adds actorID to the unread notification of the group, creating it when there is none
+func Notify(userID uint, notificationType string, articleID *uint, actorID uint) error {
+	db := DB.Get()
+	return db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		var notification struct {
+			ID uint
+		}
+		err := tx.Raw("INSERT INTO notifications (user_id, type, article_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?) "+
+			"ON CONFLICT (user_id, type, (COALESCE(article_id, 0))) WHERE read_at IS NULL "+
+			"DO UPDATE SET updated_at = EXCLUDED.updated_at RETURNING id",
+			userID, notificationType, articleID, now, now).Scan(&notification).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec("INSERT INTO notification_actors (notification_id, actor_id, created_at) VALUES (?, ?, ?) "+
+			"ON CONFLICT (notification_id, actor_id) DO UPDATE SET created_at = EXCLUDED.created_at",
+			notification.ID, actorID, now).Error
+	})
+}
+
+// Newest activity first, with the total and unread counts
+func ListNotifications(userID uint, unreadOnly bool, limit uint, offset uint) (*[]NotificationList, uint, uint, error) {
+	db := DB.Get()
+	filter := "notifications.user_id = ?"
+	if unreadOnly {
+		filter += " AND notifications.read_at IS NULL"
+	}
+
+	var result []NotificationList
+	err := db.Raw("SELECT notifications.*, articles.slug AS article_slug, articles.title AS article_title, "+
+		"(SELECT COUNT(*) FROM notification_actors WHERE notification_actors.notification_id = notifications.id) AS actors_count "+
+		"FROM notifications LEFT JOIN articles ON articles.id = notifications.article_id AND articles.deleted_at IS NULL "+
+		"WHERE "+filter+" ORDER BY notifications.updated_at DESC LIMIT ? OFFSET ?", userID, limit, offset).
+		Scan(&result).Error
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	var counts struct {
+		Count  uint
+		Unread uint
+	}
+	err = db.Raw("SELECT COUNT(*) AS count, COUNT(*) FILTER (WHERE read_at IS NULL) AS unread "+
+		"FROM notifications WHERE user_id = ?", userID).Scan(&counts).Error
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	count := counts.Count
+	if unreadOnly {
+		count = counts.Unread
+	}
+	if result == nil {
+		result = []NotificationList{}
+	}
+	return &result, count, counts.Unread, nil
+}
+
+// Up to perNotification latest actors of every notification in ids, newest first.
+// Following tells whether userID follows the actor
+func ListNotificationActors(userID uint, ids []uint, perNotification uint) (*[]NotificationActorList, error) {
+	db := DB.Get()
+	result := []NotificationActorList{}
+	if len(ids) == 0 {
+		return &result, nil
+	}
+	err := db.Raw("SELECT latest.notification_id, users.*, EXISTS (SELECT 1 FROM follows "+
+		"WHERE follows.followed_by_id = ? AND follows.following_id = users.id) AS following "+
+		"FROM (SELECT notification_id, actor_id, created_at, ROW_NUMBER() OVER "+
+		"(PARTITION BY notification_id ORDER BY created_at DESC) AS position "+
+		"FROM notification_actors WHERE notification_id IN (?)) AS latest "+
+		"JOIN users ON users.id = latest.actor_id WHERE latest.position <= ? "+
+		"ORDER BY latest.notification_id, latest.created_at DESC", userID, ids, perNotification).
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Returns false when userID has no such notification
+func MarkNotificationRead(userID uint, id uint) (bool, error) {
+	db := DB.Get()
+	result := db.Model(&Notification{}).Where("id = ? AND user_id = ?", id, userID).
+		Where("read_at IS NULL").UpdateColumn("read_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+	// already read counts as found
+	var count int
+	err := db.Model(&Notification{}).Where("id = ? AND user_id = ?", id, userID).Count(&count).Error
+	return count > 0, err
+}
+
+func MarkAllNotificationsRead(userID uint) error {
+	db := DB.Get()
+	return db.Model(&Notification{}).Where("user_id = ? AND read_at IS NULL", userID).UpdateColumn("read_at", time.Now()).Error
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"../DB"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+type PasswordReset struct {
+	gorm.Model
+	UserID    uint   `gorm:"index"`
+	TokenHash string `gorm:"unique_index"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+func CreatePasswordReset(userID uint, tokenHash string, expiresAt time.Time) error {
+	db := DB.Get()
+	return db.Create(&PasswordReset{
+		UserID:    userID,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+	}).Error
+}
+
+// Sets new password hash if reset token is unused and not expired.
+// All other reset tokens and all refresh tokens of the user are invalidated
+func ResetPassword(tokenHash string, passwordHash string) (*User, error) {
+	db := DB.Get()
+	var user User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var reset PasswordReset
+		findErr := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, time.Now()).
+			First(&reset).Error
+		if findErr != nil {
+			return findErr
+		}
+		used := tx.Model(&PasswordReset{}).
+			Where("user_id = ? AND used_at IS NULL", reset.UserID).
+			Update("used_at", time.Now())
+		if used.Error != nil {
+			return used.Error
+		}
+		if used.RowsAffected == 0 {
+			return fmt.Errorf("reset token was already used")
+		}
+		userErr := tx.First(&user, reset.UserID).Error
+		if userErr != nil {
+			return userErr
+		}
+		saveErr := tx.Model(&user).Update("password", passwordHash).Error
+		if saveErr != nil {
+			return saveErr
+		}
+		return tx.Model(&RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", user.ID).
+			Update("revoked_at", time.Now()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"../DB"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"strings"
+)
+
+const (
+	SortRelevance = "relevance"
+	SortFollowers = "followers"
+)
+
+type SearchProfile struct {
+	User
+	Following      bool
+	FollowersCount uint
+}
+
+// Set by migrateProfileSearch when pg_trgm is installed, search falls back to prefix and substring matching without it
+var trigramSearch = false
+
+// pg_trgm needs a superuser or a trusted extension, when it can not be created search works without it
+func migrateProfileSearch(db *gorm.DB) error {
+	err := db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error
+	if err != nil {
+		return err
+	}
+	err = db.Exec("CREATE INDEX IF NOT EXISTS idx_users_username_trgm ON users USING gin (lower(username) gin_trgm_ops)").Error
+	if err != nil {
+		return err
+	}
+	err = db.Exec("CREATE INDEX IF NOT EXISTS idx_users_bio_trgm ON users USING gin (bio gin_trgm_ops)").Error
+	if err != nil {
+		return err
+	}
+	trigramSearch = true
+	return nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Users matching query in username or bio, an empty query lists everybody.
+// Users hidden from viewerID by blocks and mutes are left out, viewerID 0 sees all
+func SearchProfiles(query string, sort string, viewerID uint, limit uint, offset uint) (*[]SearchProfile, uint, error) {
+	db := DB.Get()
+	q := strings.ToLower(strings.TrimSpace(query))
+	prefix := escapeLike(q) + "%"
+	substring := "%" + escapeLike(q) + "%"
+
+	where := "NOT users.placeholder "
+	whereArgs := []interface{}{}
+	if q != "" {
+		match := `lower(users.username) LIKE ? ESCAPE '\' OR users.bio ILIKE ? ESCAPE '\'`
+		whereArgs = append(whereArgs, substring, substring)
+		if trigramSearch {
+			match += " OR lower(users.username) % ?"
+			whereArgs = append(whereArgs, q)
+		}
+		where += "AND (" + match + ") "
+	}
+	if viewerID != 0 {
+		where += "AND users.id NOT IN " + hiddenAuthors(viewerID) + " "
+	}
+
+	relevance := `CASE WHEN lower(users.username) = ? THEN 3 WHEN lower(users.username) LIKE ? ESCAPE '\' THEN 2 ELSE 0 END`
+	relevanceArgs := []interface{}{q, prefix}
+	if trigramSearch {
+		relevance += " + similarity(lower(users.username), ?)"
+		relevanceArgs = append(relevanceArgs, q)
+	}
+	order := "relevance DESC, followers_count DESC"
+	if sort == SortFollowers {
+		order = "followers_count DESC, relevance DESC"
+	}
+
+	args := append([]interface{}{viewerID}, relevanceArgs...)
+	args = append(args, whereArgs...)
+	args = append(args, limit, offset)
+	var result []SearchProfile
+	err := db.Raw("SELECT users.*, "+
+		"EXISTS (SELECT 1 FROM follows WHERE follows.followed_by_id = ? AND follows.following_id = users.id) AS following, "+
+		"(SELECT COUNT(*) FROM follows WHERE follows.following_id = users.id) AS followers_count, "+
+		fmt.Sprintf("(%s) AS relevance ", relevance)+
+		"FROM users WHERE "+where+
+		"ORDER BY "+order+", lower(users.username) LIMIT ? OFFSET ?", args...).
+		Scan(&result).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var count struct {
+		Count uint
+	}
+	err = db.Raw("SELECT COUNT(*) AS count FROM users WHERE "+where, whereArgs...).Scan(&count).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	if result == nil {
+		result = []SearchProfile{}
+	}
+	return &result, count.Count, nil
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"../DB"
+)
+
+type ProfileStats struct {
+	ArticlesCount  uint
+	FavoritesCount uint
+	FollowersCount uint
+	FollowingCount uint
+}
+
+// Counts for the profile of userID in one query, every count is served by an index
+func GetProfileStats(userID uint) (*ProfileStats, error) {
+	db := DB.Get()
+	var stats ProfileStats
+	err := db.Raw("SELECT "+
+		"(SELECT COUNT(*) FROM articles WHERE author_id = ? AND deleted_at IS NULL) AS articles_count, "+
+		"(SELECT COUNT(*) FROM favorites JOIN articles ON articles.id = favorites.article_id "+
+		"WHERE articles.author_id = ? AND articles.deleted_at IS NULL) AS favorites_count, "+
+		"(SELECT COUNT(*) FROM follows WHERE following_id = ?) AS followers_count, "+
+		"(SELECT COUNT(*) FROM follows WHERE followed_by_id = ?) AS following_count",
+		userID, userID, userID, userID).Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"../DB"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// A sign in on one device. ID is the refresh token family, access tokens carry it in their claims,
+// so revoking the family signs the session out everywhere
+type Session struct {
+	ID         string `gorm:"primary_key"`
+	UserID     uint   `gorm:"index"`
+	UserAgent  string `gorm:"size:512"`
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+}
+
+// Creates the session together with its first refresh token
+func CreateSession(session *Session, tokenHash string, expiresAt time.Time) error {
+	db := DB.Get()
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(session).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&RefreshToken{
+			UserID:    session.UserID,
+			Family:    session.ID,
+			TokenHash: tokenHash,
+			ExpiresAt: expiresAt,
+		}).Error
+	})
+}
+
+// Sessions that can still be refreshed: not revoked and with an unexpired refresh token
+func ListSessions(userID uint) (*[]Session, error) {
+	db := DB.Get()
+	var sessions []Session
+	err := db.Where("user_id = ?", userID).
+		Where("NOT EXISTS (SELECT 1 FROM refresh_tokens r WHERE r.family = sessions.id AND r.revoked_at IS NOT NULL)").
+		Where("EXISTS (SELECT 1 FROM refresh_tokens r WHERE r.family = sessions.id AND r.expires_at > ?)", time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return &sessions, nil
+}
+
+// Revokes the refresh family and removes the session, returns false if user has no such session
+func DeleteSession(userID uint, id string) (bool, error) {
+	db := DB.Get()
+	deleted := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", id, userID).Delete(&Session{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		deleted = true
+		return tx.Model(&RefreshToken{}).
+			Where("family = ? AND revoked_at IS NULL", id).
+			Update("revoked_at", time.Now()).Error
+	})
+	return deleted, err
+}
+
+// Skips the write if the session was seen less than interval ago
+func TouchSession(id string, interval time.Duration) error {
+	db := DB.Get()
+	now := time.Now()
+	return db.Model(&Session{}).
+		Where("id = ? AND last_seen_at < ?", id, now.Add(-interval)).
+		UpdateColumn("last_seen_at", now).Error
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"../DB"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// Refresh tokens issued from one sign in share a Family.
+// Every refresh marks the old token used and issues a new one in the same family,
+// so presenting a used token again means it was stolen and the whole family gets revoked
+type RefreshToken struct {
+	gorm.Model
+	UserID    uint
+	Family    string `gorm:"index"`
+	TokenHash string `gorm:"unique_index"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+// Access tokens revoked before their expiration, kept until they would have expired anyway
+type RevokedToken struct {
+	TokenID   string `gorm:"primary_key"`
+	ExpiresAt time.Time
+}
+
+func GetRefreshToken(tokenHash string) (*RefreshToken, error) {
+	db := DB.Get()
+	var token RefreshToken
+	err := db.Where(&RefreshToken{TokenHash: tokenHash}).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func RotateRefreshToken(old *RefreshToken, tokenHash string, expiresAt time.Time) error {
+	db := DB.Get()
+	return db.Transaction(func(tx *gorm.DB) error {
+		// only one of concurrent refreshes with the same token may win
+		used := tx.Model(&RefreshToken{}).
+			Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", old.ID).
+			Update("used_at", time.Now())
+		if used.Error != nil {
+			return used.Error
+		}
+		if used.RowsAffected == 0 {
+			return fmt.Errorf("refresh token was already used")
+		}
+		return tx.Create(&RefreshToken{
+			UserID:    old.UserID,
+			Family:    old.Family,
+			TokenHash: tokenHash,
+			ExpiresAt: expiresAt,
+		}).Error
+	})
+}
+
+func RevokeRefreshFamily(family string) error {
+	db := DB.Get()
+	return db.Model(&RefreshToken{}).
+		Where("family = ? AND revoked_at IS NULL", family).
+		Update("revoked_at", time.Now()).Error
+}
+
+func IsRefreshFamilyRevoked(family string) bool {
+	db := DB.Get()
+	var count int
+	err := db.Model(&RefreshToken{}).Where("family = ? AND revoked_at IS NOT NULL", family).Count(&count).Error
+	if err != nil {
+		// fail closed, a token we can not check is not trusted
+		return true
+	}
+	return count > 0
+}
+
+func RevokeToken(tokenID string, expiresAt time.Time) error {
+	db := DB.Get()
+	return db.Save(&RevokedToken{TokenID: tokenID, ExpiresAt: expiresAt}).Error
+}
+
+// Revokes a single use token and tells whether this was its first use
+func UseTokenOnce(tokenID string, expiresAt time.Time) (bool, error) {
+	db := DB.Get()
+	result := db.Exec("INSERT INTO revoked_tokens (token_id, expires_at) VALUES (?, ?) ON CONFLICT DO NOTHING", tokenID, expiresAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func IsTokenRevoked(tokenID string) bool {
+	db := DB.Get()
+	var count int
+	err := db.Model(&RevokedToken{}).Where(&RevokedToken{TokenID: tokenID}).Count(&count).Error
+	if err != nil {
+		return true
+	}
+	return count > 0
+}
+
+func PurgeExpiredTokens() error {
+	db := DB.Get()
+	now := time.Now()
+	err := db.Where("expires_at < ?", now).Delete(&RevokedToken{}).Error
+	if err != nil {
+		return err
+	}
+	err = db.Unscoped().Where("expires_at < ?", now).Delete(&RefreshToken{}).Error
+	if err != nil {
+		return err
+	}
+	// sessions without refresh tokens can not be used anymore
+	return db.Where("created_at < ? AND NOT EXISTS (SELECT 1 FROM refresh_tokens r WHERE r.family = sessions.id)", now.Add(-time.Hour)).
+		Delete(&Session{}).Error
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"../DB"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+type RecoveryCode struct {
+	ID       uint   `gorm:"primary_key"`
+	UserID   uint   `gorm:"index"`
+	CodeHash string `gorm:"unique_index"`
+	UsedAt   *time.Time
+}
+
+// Stores a secret that is not used for sign in until enrollment is confirmed with EnableTOTP
+func SetPendingTOTPSecret(userID uint, secret string) error {
+	db := DB.Get()
+	return db.Model(&User{}).Where("id = ? AND totp_enabled = false", userID).
+		Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error
+}
+
+// Turns on two factor sign in and replaces recovery codes
+func EnableTOTP(userID uint, step int64, codeHashes []string) error {
+	db := DB.Get()
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{"totp_enabled": true, "totp_last_step": step}).Error
+		if err != nil {
+			return err
+		}
+		rmErr := tx.Where(&RecoveryCode{UserID: userID}).Delete(&RecoveryCode{}).Error
+		if rmErr != nil {
+			return rmErr
+		}
+		for _, hash := range codeHashes {
+			codeErr := tx.Create(&RecoveryCode{UserID: userID, CodeHash: hash}).Error
+			if codeErr != nil {
+				return codeErr
+			}
+		}
+		return nil
+	})
+}
+
+func DisableTOTP(userID uint) error {
+	db := DB.Get()
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{"totp_enabled": false, "totp_secret": "", "totp_last_step": 0}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where(&RecoveryCode{UserID: userID}).Delete(&RecoveryCode{}).Error
+	})
+}
+
+// Records that a time step was used, returns false if this or a later step was used already
+func UseTOTPStep(userID uint, step int64) (bool, error) {
+	db := DB.Get()
+	result := db.Model(&User{}).Where("id = ? AND totp_last_step < ?", userID, step).Update("totp_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Marks recovery code used, returns false if there is no such unused code
+func UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	db := DB.Get()
+	result := db.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
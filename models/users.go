@@ -4,25 +4,50 @@ import (
 	"../DB"
 	"errors"
 	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"time"
 )
 
 type User struct {
-	ID           uint    `gorm:"primary_key"`
-	Username     string  `gorm:"column:username"`
-	Email        string  `gorm:"column:email;unique_index"`
-	Bio          string  `gorm:"column:bio;size:1024"`
-	Image        *string `gorm:"column:image"`
-	PasswordHash string  `gorm:"column:password;not null"`
+	ID            uint    `gorm:"primary_key"`
+	Username      string  `gorm:"column:username"`
+	Email         string  `gorm:"column:email;unique_index"`
+	EmailVerified bool    `gorm:"column:email_verified;not null;default:false"`
+	Bio           string  `gorm:"column:bio;size:1024"`
+	Image         *string `gorm:"column:image"`
+	PasswordHash  string  `gorm:"column:password;not null"`
+	TOTPSecret    string  `gorm:"column:totp_secret"`
+	TOTPEnabled   bool    `gorm:"column:totp_enabled;not null;default:false"`
+	TOTPLastStep  int64   `gorm:"column:totp_last_step;not null;default:0"`
+	Role          string  `gorm:"column:role;not null;default:'user'"`
+	// articles of a private account are only shown to followers it approved
+	Private bool `gorm:"column:private;not null;default:false"`
+	// empty for users who signed up before it was recorded
+	CreatedAt *time.Time `gorm:"column:created_at"`
+	// only set on the deleted user placeholder, see DeletedUserEmail
+	Placeholder bool `gorm:"column:placeholder;not null;default:false"`
 }
 
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var Roles = []string{RoleUser, RoleModerator, RoleAdmin}
+
 type Follow struct {
-	FollowingID  uint `gorm:"primaryKey;autoIncrement:false"`
-	FollowedByID uint `gorm:"primaryKey;autoIncrement:false"`
+	FollowingID  uint `gorm:"primaryKey;autoIncrement:false;index"`
+	FollowedByID uint `gorm:"primaryKey;autoIncrement:false;index"`
 }
 
 func (u *User) Save() error {
 	db := DB.Get()
-	return db.Save(&u).Error
+	err := db.Save(&u).Error
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" && pqErr.Constraint == usernameIndex {
+		return ErrUsernameTaken
+	}
+	return err
 }
 
 func GetUser(email string) (*User, error) {
@@ -35,16 +60,65 @@ func GetUser(email string) (*User, error) {
 	return &user, nil
 }
 
+// Usernames are unique ignoring case, so lookup ignores case too
 func GetUserByUsername(username string) (*User, error) {
 	db := DB.Get()
 	var user User
-	err := db.Where(&User{Username: username}).First(&user).Error
+	err := db.Where("lower(username) = lower(?)", username).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// True when another user than exceptUserID has username, in any case
+func IsUsernameTaken(username string, exceptUserID uint) bool {
+	db := DB.Get()
+	var count int
+	err := db.Model(&User{}).Where("lower(username) = lower(?) AND id <> ?", username, exceptUserID).Count(&count).Error
+	if err != nil {
+		return true
+	}
+	return count > 0
+}
+
+// Returned by Save when a concurrent sign up or rename took the username first
+var ErrUsernameTaken = errors.New("username is already taken")
+
+const usernameIndex = "idx_users_username_lower"
+
+// Renames users whose username differs only in case from an older user's by appending their id,
+// then adds the unique index on lower(username)
+func migrateUsernames(db *gorm.DB) error {
+	err := db.Exec("UPDATE users SET username = users.username || '-' || users.id " +
+		"FROM (SELECT id, row_number() OVER (PARTITION BY lower(username) ORDER BY id) AS n FROM users) AS duplicates " +
+		"WHERE users.id = duplicates.id AND duplicates.n > 1").Error
+	if err != nil {
+		return err
+	}
+	return db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS " + usernameIndex + " ON users (lower(username))").Error
+}
+
+func GetUserByID(id uint) (*User, error) {
+	db := DB.Get()
+	var user User
+	err := db.First(&user, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
+// Marks email verified only if user still has this email, returns false otherwise
+func SetEmailVerified(userID uint, email string) (bool, error) {
+	db := DB.Get()
+	result := db.Model(&User{}).Where("id = ? AND email = ?", userID, email).Update("email_verified", true)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
 func IsFollowing(followedByID uint, followingID uint) bool {
 	db := DB.Get()
 	var follow Follow
@@ -86,3 +160,48 @@ func RemoveFollow(followedByID uint, followingID uint) error {
 	}
 	return err
 }
+
+func SetUserImage(userID uint, image *string) error {
+	db := DB.Get()
+	return db.Model(&User{}).Where("id = ?", userID).UpdateColumn("image", image).Error
+}
+
+func SetUserRole(userID uint, role string) error {
+	db := DB.Get()
+	return db.Model(&User{}).Where("id = ?", userID).UpdateColumn("role", role).Error
+}
+
+// Grants role to users with given emails who verified them, anyone could have signed up with an
+// unverified address. Returns the emails that match no verified user
+func SetRoleByEmails(emails []string, role string) ([]string, error) {
+	if len(emails) == 0 {
+		return nil, nil
+	}
+	db := DB.Get()
+	err := db.Model(&User{}).Where("email IN (?) AND email_verified = true", emails).UpdateColumn("role", role).Error
+	if err != nil {
+		return nil, err
+	}
+	var granted []string
+	err = db.Model(&User{}).Where("email IN (?) AND email_verified = true", emails).Pluck("email", &granted).Error
+	if err != nil {
+		return nil, err
+	}
+	found := map[string]bool{}
+	for _, email := range granted {
+		found[email] = true
+	}
+	var skipped []string
+	for _, email := range emails {
+		if !found[email] {
+			skipped = append(skipped, email)
+		}
+	}
+	return skipped, nil
+}
+
+// Replaces the hash only if it was not changed meanwhile, e.g. by a password reset
+func UpdatePasswordHash(userID uint, oldHash string, newHash string) error {
+	db := DB.Get()
+	return db.Model(&User{}).Where("id = ? AND password = ?", userID, oldHash).UpdateColumn("password", newHash).Error
+}
@@ -0,0 +1,394 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// External OpenID Connect provider used for sign in with authorization code flow and PKCE.
+// Endpoints and keys are discovered from the issuer
+type Provider struct {
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"clientId"`
+	ClientSecret string   `json:"clientSecret"`
+	RedirectURL  string   `json:"redirectUrl"`
+	Scopes       []string `json:"scopes"`
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      map[string]interface{}
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Some providers send aud as a string and some as a list
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	err := json.Unmarshal(data, &list)
+	if err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, el := range a {
+		if el == s {
+			return true
+		}
+	}
+	return false
+}
+
+type IDClaims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	ExpiresAt         int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+	Picture           string   `json:"picture"`
+}
+
+// Allowed clock difference between us and the provider
+const leeway = time.Minute
+
+func (c *IDClaims) Valid() error {
+	now := time.Now()
+	if c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(leeway)) {
+		return fmt.Errorf("id token is expired")
+	}
+	if c.IssuedAt != 0 && now.Add(leeway).Before(time.Unix(c.IssuedAt, 0)) {
+		return fmt.Errorf("id token is issued in the future")
+	}
+	return nil
+}
+
+var client = &http.Client{Timeout: time.Second * 10}
+
+var providers = map[string]*Provider{}
+
+var providersMu sync.RWMutex
+
+func SetProviders(list []*Provider) error {
+	result := map[string]*Provider{}
+	for _, p := range list {
+		if p.Name == "" || p.Issuer == "" || p.ClientID == "" || p.RedirectURL == "" {
+			return fmt.Errorf("oidc providers should have name, issuer, clientId and redirectUrl")
+		}
+		if _, found := result[p.Name]; found {
+			return fmt.Errorf("duplicate oidc provider %s", p.Name)
+		}
+		result[p.Name] = p
+	}
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers = result
+	return nil
+}
+
+// Reads a json list of providers: [{"name": "...", "issuer": "...", "clientId": "...", "clientSecret": "...", "redirectUrl": "..."}]
+func LoadProvidersFile(path string) error {
+	data, readErr := ioutil.ReadFile(path)
+	if readErr != nil {
+		return fmt.Errorf("could not read oidc providers file: %s", readErr)
+	}
+	var list []*Provider
+	err := json.Unmarshal(data, &list)
+	if err != nil {
+		return fmt.Errorf("could not parse oidc providers file: %s", err)
+	}
+	return SetProviders(list)
+}
+
+func GetProvider(name string) (*Provider, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	p, found := providers[name]
+	return p, found
+}
+
+func ProviderNames() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	result := []string{}
+	for name := range providers {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(fmt.Sprintf("Could not read random bytes: %s", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Random values for state, nonce and PKCE code verifier of one sign in attempt
+func NewState() string {
+	return randomString()
+}
+
+func NewNonce() string {
+	return randomString()
+}
+
+func NewCodeVerifier() string {
+	return randomString()
+}
+
+// S256 code challenge from RFC 7636
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func getJSON(u string, value interface{}) error {
+	resp, err := client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(value)
+}
+
+func (p *Provider) discover() (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	var d discovery
+	err := getJSON(strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", &d)
+	if err != nil {
+		return nil, fmt.Errorf("could not discover oidc provider %s: %s", p.Name, err)
+	}
+	if d.Issuer != p.Issuer {
+		return nil, fmt.Errorf("oidc provider %s reports issuer %s", p.Name, d.Issuer)
+	}
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+func (p *Provider) scopes() string {
+	if len(p.Scopes) == 0 {
+		return "openid email profile"
+	}
+	return strings.Join(p.Scopes, " ")
+}
+
+// Url to send the user to, the provider redirects back to RedirectURL with code and state
+func (p *Provider) AuthCodeURL(state string, nonce string, verifier string) (string, error) {
+	d, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientID)
+	query.Set("redirect_uri", p.RedirectURL)
+	query.Set("scope", p.scopes())
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", CodeChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+	separator := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return d.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Redeems authorization code and returns verified claims of the id token
+func (p *Provider) Exchange(code string, verifier string, nonce string) (*IDClaims, error) {
+	d, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", verifier)
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+	resp, postErr := client.PostForm(d.TokenEndpoint, form)
+	if postErr != nil {
+		return nil, fmt.Errorf("could not redeem authorization code: %s", postErr)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint responded with %s", resp.Status)
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&tokens)
+	if decodeErr != nil || tokens.IDToken == "" {
+		return nil, fmt.Errorf("token endpoint response has no id token")
+	}
+	return p.VerifyIDToken(tokens.IDToken, nonce)
+}
+
+func (p *Provider) VerifyIDToken(raw string, nonce string) (*IDClaims, error) {
+	var claims IDClaims
+	token, err := jwt.ParseWithClaims(raw, &claims, p.keyFunc)
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("id token is invalid: %s", err)
+	}
+	if claims.Issuer != p.Issuer {
+		return nil, fmt.Errorf("id token is issued by %s", claims.Issuer)
+	}
+	if !claims.Audience.contains(p.ClientID) {
+		return nil, fmt.Errorf("id token is issued for another client")
+	}
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, fmt.Errorf("id token nonce does not match")
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("id token has no subject")
+	}
+	return &claims, nil
+}
+
+func (p *Provider) keyFunc(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+	default:
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	kid, _ := token.Header["kid"].(string)
+	key, found, err := p.findKey(kid, false)
+	if err == nil && !found {
+		// provider may have rotated its keys since we fetched them
+		key, found, err = p.findKey(kid, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown signing key %s", kid)
+	}
+	return key, nil
+}
+
+func (p *Provider) findKey(kid string, refresh bool) (interface{}, bool, error) {
+	d, err := p.discover()
+	if err != nil {
+		return nil, false, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.keys == nil || refresh {
+		keys, fetchErr := fetchKeys(d.JWKSURI)
+		if fetchErr != nil {
+			return nil, false, fetchErr
+		}
+		p.keys = keys
+	}
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true, nil
+		}
+	}
+	key, found := p.keys[kid]
+	return key, found, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Reads RSA and P-256 signing keys from provider JWKS, other keys are skipped
+func fetchKeys(u string) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	err := getJSON(u, &set)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch oidc provider keys: %s", err)
+	}
+	result := map[string]interface{}{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, nErr := decodeInt(k.N)
+			e, eErr := decodeInt(k.E)
+			if nErr != nil || eErr != nil {
+				continue
+			}
+			result[k.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			x, xErr := decodeInt(k.X)
+			y, yErr := decodeInt(k.Y)
+			if xErr != nil || yErr != nil {
+				continue
+			}
+			result[k.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,70 @@
+package oidc_test
+
+import (
+	"../oidc"
+	"./oidctest"
+	"net/url"
+	"testing"
+)
+
+func newProvider(t *testing.T) (*oidc.Provider, *oidctest.Server) {
+	server := oidctest.NewServer("conduit", "secret")
+	t.Cleanup(server.Close)
+	return &oidc.Provider{
+		Name:         "test",
+		Issuer:       server.Issuer(),
+		ClientID:     "conduit",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:4000/oidc/callback",
+	}, server
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	provider, server := newProvider(t)
+	server.SignInAs(oidctest.User{Subject: "123", Email: "u22@u", EmailVerified: true})
+
+	state, nonce, verifier := oidc.NewState(), oidc.NewNonce(), oidc.NewCodeVerifier()
+	authURL, err := provider.AuthCodeURL(state, nonce, verifier)
+	if err != nil {
+		t.Fatalf("could not get authorization url: %s", err)
+	}
+	parsed, _ := url.Parse(authURL)
+	if parsed.Query().Get("code_challenge") != oidc.CodeChallenge(verifier) {
+		t.Fatalf("authorization url has no PKCE challenge: %s", authURL)
+	}
+
+	code, returnedState, authErr := server.Authorize(authURL)
+	if authErr != nil {
+		t.Fatalf("could not authorize: %s", authErr)
+	}
+	if returnedState != state {
+		t.Fatalf("provider returned state %s, expected %s", returnedState, state)
+	}
+	claims, exchangeErr := provider.Exchange(code, verifier, nonce)
+	if exchangeErr != nil {
+		t.Fatalf("could not exchange code: %s", exchangeErr)
+	}
+	if claims.Subject != "123" || claims.Email != "u22@u" || !claims.EmailVerified {
+		t.Fatalf("id token has wrong claims: %+v", claims)
+	}
+}
+
+func TestExchangeNeedsVerifierAndNonce(t *testing.T) {
+	provider, server := newProvider(t)
+	server.SignInAs(oidctest.User{Subject: "123"})
+	nonce, verifier := oidc.NewNonce(), oidc.NewCodeVerifier()
+
+	authURL, _ := provider.AuthCodeURL(oidc.NewState(), nonce, verifier)
+	code, _, _ := server.Authorize(authURL)
+	_, err := provider.Exchange(code, oidc.NewCodeVerifier(), nonce)
+	if err == nil {
+		t.Fatalf("code was redeemed with another verifier")
+	}
+
+	authURL, _ = provider.AuthCodeURL(oidc.NewState(), nonce, verifier)
+	code, _, _ = server.Authorize(authURL)
+	_, err = provider.Exchange(code, verifier, oidc.NewNonce())
+	if err == nil {
+		t.Fatalf("id token with another nonce was accepted")
+	}
+}
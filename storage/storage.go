@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Keeps uploaded files by key, e.g. "avatars/1/abc-256.png"
+type Storage interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+var ErrNotFound = errors.New("file not found")
+var ErrInvalidKey = errors.New("invalid file key")
+
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9_\-]+(/[A-Za-z0-9_\-][A-Za-z0-9_.\-]*)*$`)
+
+// Keys come from urls, so only plain relative paths are accepted
+func ValidKey(key string) bool {
+	return keyPattern.MatchString(key) && !strings.Contains(key, "..")
+}
+
+// Stores files under Dir, keys are paths relative to it
+type LocalStorage struct {
+	Dir string
+}
+
+func NewLocalStorage(dir string) *LocalStorage {
+	return &LocalStorage{Dir: dir}
+}
+
+func (l *LocalStorage) path(key string) (string, error) {
+	if !ValidKey(key) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(l.Dir, filepath.FromSlash(key)), nil
+}
+
+func (l *LocalStorage) Put(key string, data []byte) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(p), 0700)
+	if err != nil {
+		return err
+	}
+	// written next to the target and renamed, so readers never see half a file
+	tmp := p + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func (l *LocalStorage) Get(key string) ([]byte, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (l *LocalStorage) Delete(key string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+var storage Storage = NewLocalStorage("storage")
+
+func SetStorage(s Storage) {
+	storage = s
+}
+
+func Put(key string, data []byte) error {
+	return storage.Put(key, data)
+}
+
+func Get(key string) ([]byte, error) {
+	return storage.Get(key)
+}
+
+func Delete(key string) error {
+	return storage.Delete(key)
+}
@@ -0,0 +1,35 @@
+package storage_test
+
+import (
+	"../storage"
+	"testing"
+)
+
+func TestLocalStorageRoundTrip(t *testing.T) {
+	s := storage.NewLocalStorage(t.TempDir())
+	err := s.Put("avatars/1/a-64.png", []byte("image"))
+	if err != nil {
+		t.Fatalf("could not put file: %s", err)
+	}
+	data, err := s.Get("avatars/1/a-64.png")
+	if err != nil || string(data) != "image" {
+		t.Fatalf("could not get file back: %s %s", data, err)
+	}
+	err = s.Delete("avatars/1/a-64.png")
+	if err != nil {
+		t.Fatalf("could not delete file: %s", err)
+	}
+	_, err = s.Get("avatars/1/a-64.png")
+	if err != storage.ErrNotFound {
+		t.Fatalf("deleted file is still there: %s", err)
+	}
+}
+
+func TestLocalStorageRejectsPathsOutside(t *testing.T) {
+	s := storage.NewLocalStorage(t.TempDir())
+	for _, key := range []string{"../secret", "/etc/passwd", "avatars/../../x", "avatars//x", ""} {
+		if err := s.Put(key, []byte("x")); err != storage.ErrInvalidKey {
+			t.Fatalf("key %q was accepted", key)
+		}
+	}
+}
@@ -1 +1 @@
-APIURL="localhost:4000" USERNAME=$(date +%s) ./spec/run-api-tests.sh
+APIURL="localhost:4000" USERNAME=$(date +%s) PASSWORD="pw$(date +%s)" ./spec/run-api-tests.sh
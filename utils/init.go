@@ -2,6 +2,9 @@ package utils
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func Port() string {
@@ -57,3 +60,134 @@ func DbPassword() string {
 	p := os.Getenv("DB_PASSWORD")
 	return p
 }
+
+// Base url for links in emails
+func AppURL() string {
+	p := os.Getenv("APP_URL")
+	if p == "" {
+		p = "http://localhost:4000"
+	}
+	return p
+}
+
+// Public address of this API, used in links to files it serves
+func APIURL() string {
+	p := os.Getenv("API_URL")
+	if p == "" {
+		p = "http://localhost" + Port()
+	}
+	return p
+}
+
+// Uploaded files like avatars are kept in this directory
+func StorageDir() string {
+	p := os.Getenv("STORAGE_DIR")
+	if p == "" {
+		p = "storage"
+	}
+	return p
+}
+
+// Mail is written to files in this directory, or to stdout when it is not set
+func MailDir() string {
+	return os.Getenv("MAIL_DIR")
+}
+
+func listEnv(name string) []string {
+	result := []string{}
+	for _, a := range strings.Split(os.Getenv(name), ",") {
+		a = strings.TrimSpace(a)
+		if a != "" {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+// Comma separated actions that need verified email, e.g. "articles,comments"
+func RequireVerifiedEmail() []string {
+	return listEnv("REQUIRE_VERIFIED_EMAIL")
+}
+
+// Comma separated emails of users that are made admins on start, so the first admin can be set up.
+// Only users who verified the email are made admins
+func AdminEmails() []string {
+	return listEnv("ADMIN_EMAILS")
+}
+
+// Json keyring with signing keys, when set it replaces SIGNATURE
+func SigningKeysFile() string {
+	return os.Getenv("SIGNING_KEYS_FILE")
+}
+
+// Json list of OpenID Connect providers users can sign in with
+func OIDCProvidersFile() string {
+	return os.Getenv("OIDC_PROVIDERS_FILE")
+}
+
+func AccessTokenTTL() time.Duration {
+	return durationEnv("ACCESS_TOKEN_TTL", time.Minute*15)
+}
+
+func RefreshTokenTTL() time.Duration {
+	return durationEnv("REFRESH_TOKEN_TTL", time.Hour*24*30)
+}
+
+func PasswordMinLength() int {
+	return intEnv("PASSWORD_MIN_LENGTH", 8)
+}
+
+func PasswordMaxLength() int {
+	return intEnv("PASSWORD_MAX_LENGTH", 128)
+}
+
+// File with additional banned passwords, one per line
+func PasswordBannedFile() string {
+	return os.Getenv("PASSWORD_BANNED_FILE")
+}
+
+// Directory with breached password range files named by sha1 prefix, e.g. downloaded from Have I Been Pwned
+func BreachedPasswordsDir() string {
+	return os.Getenv("BREACHED_PASSWORDS_DIR")
+}
+
+// Tokens issued for an email, before they were bound to user id, are accepted until this RFC3339 time.
+// They lived 100 hours, so when upgrading set it once to the first deploy time plus 100 hours.
+// Unset means they are refused, a default relative to the start would reopen the window on every restart
+func EmailTokensAcceptedUntil() (time.Time, error) {
+	p := os.Getenv("EMAIL_TOKENS_ACCEPTED_UNTIL")
+	if p == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, p)
+}
+
+func intEnv(name string, fallback int) int {
+	p := os.Getenv(name)
+	if p == "" {
+		return fallback
+	}
+	i, err := strconv.Atoi(p)
+	if err != nil {
+		return fallback
+	}
+	return i
+}
+
+// Reads durations in time.ParseDuration format, e.g. "15m" or "720h"
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	p := os.Getenv(name)
+	if p == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(p)
+	if err != nil {
+		return fallback
+	}
+	return d
+}
+
+// Set when the app runs behind a reverse proxy that appends the client address to X-Forwarded-For
+func TrustProxy() bool {
+	return os.Getenv("TRUST_PROXY") == "true"
+}